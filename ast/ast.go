@@ -2,6 +2,7 @@ package ast
 
 import (
 	"bytes"
+	"math/big"
 	"strings"
 
 	"monkey/token"
@@ -10,7 +11,9 @@ import (
 // simple node interface
 type Node interface {
 	TokenLiteral() string
-	String() string // method for printing and debugging
+	String() string      // method for printing and debugging
+	Pos() token.Position // position of the first character of the node
+	End() token.Position // position immediately after the last character of the node
 }
 
 // node that represents a statemet (let, return, etc)
@@ -30,9 +33,10 @@ type Program struct {
 }
 
 type LetStatement struct {
-	Token token.Token // token.LET
-	Name  *Identifier // hold x in let x = 5;
-	Value Expression  // expression that produces the value, 5 in let x = 5;
+	Token   token.Token // token.LET, or token.CONST for bindings that can't be reassigned
+	Name    *Identifier // hold x in let x = 5;
+	Pattern Expression  // array or hash pattern in let [a, b] = arr; Name is nil when it is set
+	Value   Expression  // expression that produces the value, 5 in let x = 5;
 }
 
 type ReturnStatement struct {
@@ -51,6 +55,7 @@ type ExpressionStatement struct {
 type BlockStatement struct {
 	Token      token.Token // { token
 	Statements []Statement
+	Rbrace     token.Token // } token
 }
 
 // hold x in let x = 5;
@@ -62,6 +67,12 @@ type Identifier struct {
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+	Big   *big.Int // set instead of Value when the literal does not fit in an int64
+}
+
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
 }
 
 type Boolean struct {
@@ -69,6 +80,10 @@ type Boolean struct {
 	Value bool        // true or false
 }
 
+type NullLiteral struct {
+	Token token.Token // token.NULL
+}
+
 type StringLiteral struct {
 	Token token.Token
 	Value string
@@ -87,39 +102,137 @@ type InfixExpression struct {
 	Right    Expression
 }
 
+// assigns to an existing binding, x = 5 or x += 5
+type AssignExpression struct {
+	Token    token.Token // the assignment operator token
+	Target   Expression  // what is assigned to, x in x = 5
+	Operator string      // =, +=, -=, *= or /=
+	Value    Expression
+}
+
+// cond ? a : b
+type ConditionalExpression struct {
+	Token       token.Token // ? token
+	Condition   Expression
+	Consequence Expression
+	Alternative Expression
+}
+
+// match (value) { pattern => expr, pattern if guard => { block } }
+type MatchExpression struct {
+	Token   token.Token // match token
+	Subject Expression
+	Arms    []*MatchArm
+	Rbrace  token.Token // } token
+}
+
+// patterns are literals, identifiers that bind the value, _ that matches anything,
+// array literals that may end with ...rest, and hash literals whose values are patterns
+type MatchArm struct {
+	Pattern Expression
+	Guard   Expression // nil when the arm has no if
+	Body    Node       // an expression or a *BlockStatement
+}
+
+// ...rest in array patterns
+type SpreadExpression struct {
+	Token token.Token // ... token
+	Value Expression
+}
+
+// also an expression, let x = if (c) { 1 } else { 2 };
 type IfStatement struct {
 	Token       token.Token     // if token
 	Condition   Expression      // condition for if to be executed
 	Consequence *BlockStatement // { + code to be executed if passes
-	Alternative *BlockStatement // { + code to be executed if doesnt passes
+	Alternative *BlockStatement // { + code to be executed if doesnt passes, holds the nested if of else if
+}
+
+type WhileStatement struct {
+	Token     token.Token     // while token
+	Condition Expression      // loop runs while the condition is truthy
+	Body      *BlockStatement // { + code executed on every iteration
+}
+
+// for (v in iterable) or for (k, v in iterable)
+type ForStatement struct {
+	Token    token.Token     // for token
+	Key      *Identifier     // index or hash key, nil when only the value is bound
+	Value    *Identifier     // element of the iterable
+	Iterable Expression      // array, hash, string or range
+	Body     *BlockStatement // { + code executed for every element
+}
+
+// try { } catch (e) { } finally { }, at least one of catch and finally is present
+type TryStatement struct {
+	Token   token.Token     // try token
+	Block   *BlockStatement // { + code whose errors are caught
+	Param   *Identifier     // catch (e), nil when the error is not bound
+	Catch   *BlockStatement // { + code run when the block fails, nil without catch
+	Finally *BlockStatement // { + code run after the block and catch in every case, nil without finally
+}
+
+type ThrowStatement struct {
+	Token token.Token // throw token
+	Value Expression  // value that is thrown
+}
+
+type BreakStatement struct {
+	Token token.Token // break token
+}
+
+type ContinueStatement struct {
+	Token token.Token // continue token
 }
 
+// also the arrow form x => x * 2, whose Token is the => token and whose expression body is wrapped in a block
 type FunctionLiteral struct {
 	Token     token.Token     // fn token
-	Arguments []*Identifier   // list containing all of the arguments
+	Name      string          // name of the declaration or let binding, empty for anonymous functions
+	Arguments []Expression    // identifiers, patterns, defaults (x = 1) and a last ...rest
 	Body      *BlockStatement // function body
 }
 
+// fn name(x) { ... }, bound before any other statement of its block runs
+type FunctionDeclaration struct {
+	Token    token.Token // fn token
+	Name     *Identifier
+	Function *FunctionLiteral
+}
+
+// name: value in the arguments of a call
+type KeywordArgument struct {
+	Token token.Token // : token
+	Name  *Identifier
+	Value Expression
+}
+
+// x |> f(y) is parsed as the call f(x, y), with the |> token as Token
 type CallExpression struct {
 	Token     token.Token // ( token
 	Function  Expression  // identifier or function literal
 	Arguments []Expression
+	Rparen    token.Token // ) token
 }
 
 type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
+	Rbracket token.Token // ] token
 }
 
 type IndexExpression struct {
-	Token token.Token
-	Left  Expression
-	Index Expression
+	Token    token.Token
+	Left     Expression
+	Index    Expression
+	Rbracket token.Token // ] token, not set for a?.name
+	Optional bool        // a?[i] and a?.name, null when a is null
 }
 
 type HashLiteral struct {
-	Token token.Token
-	Pairs map[Expression]Expression
+	Token  token.Token
+	Pairs  map[Expression]Expression
+	Rbrace token.Token // } token
 }
 
 func (lt *LetStatement) statementNode()       {}
@@ -129,7 +242,11 @@ func (lt *LetStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(lt.TokenLiteral() + " ")
-	out.WriteString(lt.Name.String())
+	if lt.Pattern != nil {
+		out.WriteString(lt.Pattern.String())
+	} else {
+		out.WriteString(lt.Name.String())
+	}
 	out.WriteString(" = ")
 
 	if lt.Value != nil {
@@ -192,11 +309,20 @@ func (bl *Boolean) TokenLiteral() string { return bl.Token.Literal }
 
 func (bl *Boolean) String() string { return bl.Token.Literal }
 
+func (nl *NullLiteral) expressionNode()      {}
+func (nl *NullLiteral) TokenLiteral() string { return nl.Token.Literal }
+func (nl *NullLiteral) String() string       { return nl.Token.Literal }
+
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 
 func (il *IntegerLiteral) String() string { return il.Token.Literal }
 
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+
+func (fl *FloatLiteral) String() string { return fl.Token.Literal }
+
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
 
@@ -230,7 +356,75 @@ func (ie *InfixExpression) String() string {
 	return out.String()
 }
 
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" " + ae.Operator + " ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+func (ce *ConditionalExpression) expressionNode()      {}
+func (ce *ConditionalExpression) TokenLiteral() string { return ce.Token.Literal }
+
+func (ce *ConditionalExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(ce.Condition.String())
+	out.WriteString(" ? ")
+	out.WriteString(ce.Consequence.String())
+	out.WriteString(" : ")
+	out.WriteString(ce.Alternative.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+
+	out.WriteString("match")
+	out.WriteString(me.Subject.String())
+	out.WriteString(" { ")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+	out.WriteString(ma.Pattern.String())
+	if ma.Guard != nil {
+		out.WriteString(" if ")
+		out.WriteString(ma.Guard.String())
+	}
+	out.WriteString(" => ")
+	out.WriteString(ma.Body.String())
+
+	return out.String()
+}
+
+func (se *SpreadExpression) expressionNode()      {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadExpression) String() string       { return "..." + se.Value.String() }
+
 func (i *IfStatement) statementNode()       {}
+func (i *IfStatement) expressionNode()      {}
 func (i *IfStatement) TokenLiteral() string { return i.Token.Literal }
 
 func (i *IfStatement) String() string {
@@ -249,13 +443,106 @@ func (i *IfStatement) String() string {
 	return out.String()
 }
 
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(ws.Token.Literal)
+
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(fs.Token.Literal)
+
+	out.WriteString("(")
+	if fs.Key != nil {
+		out.WriteString(fs.Key.String() + ", ")
+	}
+	out.WriteString(fs.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+func (ts *TryStatement) statementNode()       {}
+func (ts *TryStatement) TokenLiteral() string { return ts.Token.Literal }
+
+func (ts *TryStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(ts.Token.Literal)
+	out.WriteString(" ")
+	out.WriteString(ts.Block.String())
+
+	if ts.Catch != nil {
+		out.WriteString(" catch ")
+		if ts.Param != nil {
+			out.WriteString("(" + ts.Param.String() + ") ")
+		}
+		out.WriteString(ts.Catch.String())
+	}
+
+	if ts.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(ts.Finally.String())
+	}
+
+	return out.String()
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) String() string {
+	return ts.Token.Literal + " " + ts.Value.String() + ";"
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+
+func (bs *BreakStatement) String() string { return bs.Token.Literal + ";" }
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+
+func (cs *ContinueStatement) String() string { return cs.Token.Literal + ";" }
+
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
 
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
+	if fl.Token.Type == token.ARROW {
+		params := []string{}
+		for _, arg := range fl.Arguments {
+			params = append(params, arg.String())
+		}
+		out.WriteString("(" + strings.Join(params, ", ") + ") => ")
+		out.WriteString(fl.Body.String())
+		return out.String()
+	}
+
 	out.WriteString(fl.TokenLiteral())
+	out.WriteString(fl.signature())
+	return out.String()
+}
+
+// parameters and body
+func (fl *FunctionLiteral) signature() string {
+	var out bytes.Buffer
+
 	out.WriteString("(")
 
 	for n, arg := range fl.Arguments {
@@ -271,6 +558,18 @@ func (fl *FunctionLiteral) String() string {
 	return out.String()
 }
 
+func (fd *FunctionDeclaration) statementNode()       {}
+func (fd *FunctionDeclaration) TokenLiteral() string { return fd.Token.Literal }
+
+func (fd *FunctionDeclaration) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(fd.TokenLiteral() + " ")
+	out.WriteString(fd.Name.String())
+	out.WriteString(fd.Function.signature())
+	return out.String()
+}
+
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
 
@@ -278,7 +577,7 @@ func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(ce.Function.String())
-	out.WriteString(ce.TokenLiteral())
+	out.WriteString("(")
 
 	for n, arg := range ce.Arguments {
 		out.WriteString(arg.String())
@@ -312,6 +611,10 @@ func (al *ArrayLiteral) String() string {
 	return out.String()
 }
 
+func (ka *KeywordArgument) expressionNode()      {}
+func (ka *KeywordArgument) TokenLiteral() string { return ka.Token.Literal }
+func (ka *KeywordArgument) String() string       { return ka.Name.String() + ": " + ka.Value.String() }
+
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
 
@@ -338,6 +641,9 @@ func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
 	out.WriteString(ie.Left.String())
+	if ie.Optional {
+		out.WriteString("?")
+	}
 	out.WriteString("[")
 	out.WriteString(ie.Index.String())
 	out.WriteString("])")
@@ -362,3 +668,194 @@ func (p *Program) String() string {
 
 	return out.String()
 }
+
+// start of n, or the start of tk if n was not parsed
+func startOf(n Node, tk token.Token) token.Position {
+	if n != nil {
+		return n.Pos()
+	}
+	return tk.Pos
+}
+
+// end of n, or the end of tk if n was not parsed
+func endOf(n Node, tk token.Token) token.Position {
+	if n != nil {
+		return n.End()
+	}
+	return tk.End
+}
+
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+	return token.Position{}
+}
+
+func (lt *LetStatement) Pos() token.Position { return lt.Token.Pos }
+func (lt *LetStatement) End() token.Position {
+	if lt.Value != nil {
+		return lt.Value.End()
+	}
+	if lt.Pattern != nil {
+		return lt.Pattern.End()
+	}
+	if lt.Name != nil {
+		return lt.Name.End()
+	}
+	return lt.Token.End
+}
+
+func (rt *ReturnStatement) Pos() token.Position { return rt.Token.Pos }
+func (rt *ReturnStatement) End() token.Position { return endOf(rt.Value, rt.Token) }
+
+func (es *ExpressionStatement) Pos() token.Position { return startOf(es.Expression, es.Token) }
+func (es *ExpressionStatement) End() token.Position { return endOf(es.Expression, es.Token) }
+
+func (bs *BlockStatement) Pos() token.Position { return bs.Token.Pos }
+func (bs *BlockStatement) End() token.Position {
+	// the body of x => expr has no braces
+	if !bs.Rbrace.End.IsValid() && len(bs.Statements) > 0 {
+		return bs.Statements[len(bs.Statements)-1].End()
+	}
+	return bs.Rbrace.End
+}
+
+func (id *Identifier) Pos() token.Position { return id.Token.Pos }
+func (id *Identifier) End() token.Position { return id.Token.End }
+
+func (il *IntegerLiteral) Pos() token.Position { return il.Token.Pos }
+func (il *IntegerLiteral) End() token.Position { return il.Token.End }
+
+func (fl *FloatLiteral) Pos() token.Position { return fl.Token.Pos }
+func (fl *FloatLiteral) End() token.Position { return fl.Token.End }
+
+func (bl *Boolean) Pos() token.Position { return bl.Token.Pos }
+func (bl *Boolean) End() token.Position { return bl.Token.End }
+
+func (nl *NullLiteral) Pos() token.Position { return nl.Token.Pos }
+func (nl *NullLiteral) End() token.Position { return nl.Token.End }
+
+func (sl *StringLiteral) Pos() token.Position { return sl.Token.Pos }
+func (sl *StringLiteral) End() token.Position { return sl.Token.End }
+
+func (pe *PrefixExpression) Pos() token.Position { return pe.Token.Pos }
+func (pe *PrefixExpression) End() token.Position { return endOf(pe.Right, pe.Token) }
+
+func (ie *InfixExpression) Pos() token.Position { return startOf(ie.Left, ie.Token) }
+func (ie *InfixExpression) End() token.Position { return endOf(ie.Right, ie.Token) }
+
+func (ae *AssignExpression) Pos() token.Position { return startOf(ae.Target, ae.Token) }
+func (ae *AssignExpression) End() token.Position { return endOf(ae.Value, ae.Token) }
+
+func (ce *ConditionalExpression) Pos() token.Position { return startOf(ce.Condition, ce.Token) }
+func (ce *ConditionalExpression) End() token.Position {
+	if ce.Alternative != nil {
+		return ce.Alternative.End()
+	}
+	return endOf(ce.Consequence, ce.Token)
+}
+
+func (me *MatchExpression) Pos() token.Position { return me.Token.Pos }
+func (me *MatchExpression) End() token.Position { return me.Rbrace.End }
+
+func (se *SpreadExpression) Pos() token.Position { return se.Token.Pos }
+func (se *SpreadExpression) End() token.Position { return endOf(se.Value, se.Token) }
+
+func (i *IfStatement) Pos() token.Position { return i.Token.Pos }
+func (i *IfStatement) End() token.Position {
+	if i.Alternative != nil {
+		return i.Alternative.End()
+	}
+	if i.Consequence != nil {
+		return i.Consequence.End()
+	}
+	return endOf(i.Condition, i.Token)
+}
+
+func (ws *WhileStatement) Pos() token.Position { return ws.Token.Pos }
+func (ws *WhileStatement) End() token.Position {
+	if ws.Body != nil {
+		return ws.Body.End()
+	}
+	return endOf(ws.Condition, ws.Token)
+}
+
+func (fs *ForStatement) Pos() token.Position { return fs.Token.Pos }
+func (fs *ForStatement) End() token.Position {
+	if fs.Body != nil {
+		return fs.Body.End()
+	}
+	return endOf(fs.Iterable, fs.Token)
+}
+
+func (ts *TryStatement) Pos() token.Position { return ts.Token.Pos }
+func (ts *TryStatement) End() token.Position {
+	switch {
+	case ts.Finally != nil:
+		return ts.Finally.End()
+	case ts.Catch != nil:
+		return ts.Catch.End()
+	case ts.Block != nil:
+		return ts.Block.End()
+	}
+	return ts.Token.End
+}
+
+func (ts *ThrowStatement) Pos() token.Position { return ts.Token.Pos }
+func (ts *ThrowStatement) End() token.Position { return endOf(ts.Value, ts.Token) }
+
+func (bs *BreakStatement) Pos() token.Position { return bs.Token.Pos }
+func (bs *BreakStatement) End() token.Position { return bs.Token.End }
+
+func (cs *ContinueStatement) Pos() token.Position { return cs.Token.Pos }
+func (cs *ContinueStatement) End() token.Position { return cs.Token.End }
+
+func (fl *FunctionLiteral) Pos() token.Position { return fl.Token.Pos }
+func (fl *FunctionLiteral) End() token.Position {
+	if fl.Body != nil {
+		return fl.Body.End()
+	}
+	return fl.Token.End
+}
+
+func (fd *FunctionDeclaration) Pos() token.Position { return fd.Token.Pos }
+func (fd *FunctionDeclaration) End() token.Position { return endOf(fd.Function, fd.Token) }
+
+func (ce *CallExpression) Pos() token.Position {
+	if ce.Token.Type == token.PIPE && len(ce.Arguments) > 0 {
+		return startOf(ce.Arguments[0], ce.Token)
+	}
+	return startOf(ce.Function, ce.Token)
+}
+func (ce *CallExpression) End() token.Position {
+	// x |> f has no parentheses
+	if !ce.Rparen.End.IsValid() {
+		return endOf(ce.Function, ce.Token)
+	}
+	return ce.Rparen.End
+}
+
+func (al *ArrayLiteral) Pos() token.Position { return al.Token.Pos }
+func (al *ArrayLiteral) End() token.Position { return al.Rbracket.End }
+
+func (ka *KeywordArgument) Pos() token.Position { return ka.Name.Pos() }
+func (ka *KeywordArgument) End() token.Position { return endOf(ka.Value, ka.Token) }
+
+func (ie *IndexExpression) Pos() token.Position { return startOf(ie.Left, ie.Token) }
+func (ie *IndexExpression) End() token.Position {
+	if ie.Rbracket.End.IsValid() {
+		return ie.Rbracket.End
+	}
+	return endOf(ie.Index, ie.Token)
+}
+
+func (hl *HashLiteral) Pos() token.Position { return hl.Token.Pos }
+func (hl *HashLiteral) End() token.Position { return hl.Rbrace.End }
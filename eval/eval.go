@@ -2,10 +2,16 @@ package eval
 
 import (
 	"fmt"
+	"maps"
+	"math"
+	"math/big"
+	"slices"
+	"strconv"
 	"strings"
 
 	"monkey/ast"
 	"monkey/object"
+	"monkey/token"
 )
 
 var builtins = map[string]*object.Builtin{
@@ -20,6 +26,10 @@ var builtins = map[string]*object.Builtin{
 				return &object.Integer{Value: int64(len(arg.Value))}
 			case *object.Array:
 				return &object.Integer{Value: int64(len(arg.Elements))}
+			case *object.Hash:
+				return &object.Integer{Value: int64(len(arg.Pairs))}
+			case *object.Range:
+				return object.NewBigInteger(arg.Len())
 			default:
 				return newError("argument to `len` not supported, got %s", args[0].Type())
 			}
@@ -96,6 +106,93 @@ var builtins = map[string]*object.Builtin{
 			return NULL
 		},
 	},
+	"int": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Integer, *object.BigInteger:
+				return arg
+			case *object.Float:
+				if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+					return newError("cannot convert %s to INTEGER", arg.Inspect())
+				}
+				// truncates towards zero like a go conversion
+				if arg.Value < math.MaxInt64 && arg.Value >= math.MinInt64 {
+					return &object.Integer{Value: int64(arg.Value)}
+				}
+				v, _ := big.NewFloat(arg.Value).Int(nil)
+				return object.NewBigInteger(v)
+			case *object.String:
+				v, ok := new(big.Int).SetString(strings.TrimSpace(arg.Value), 10)
+				if !ok {
+					return newError("could not parse %q as INTEGER", arg.Value)
+				}
+				return object.NewBigInteger(v)
+			default:
+				return newError("argument to `int` not supported, got %s", args[0].Type())
+			}
+		},
+	},
+	"float": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Integer, *object.BigInteger:
+				return &object.Float{Value: toFloat(arg)}
+			case *object.Float:
+				return arg
+			case *object.String:
+				v, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+				if err != nil {
+					return newError("could not parse %q as FLOAT", arg.Value)
+				}
+				return &object.Float{Value: v}
+			default:
+				return newError("argument to `float` not supported, got %s", args[0].Type())
+			}
+		},
+	},
+	"range": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) < 1 || len(args) > 3 {
+				return newError("wrong number of arguments. got=%d, want=1 to 3", len(args))
+			}
+
+			bounds := []int64{}
+			for idx, arg := range args {
+				switch arg := arg.(type) {
+				case *object.Integer:
+					bounds = append(bounds, arg.Value)
+				case *object.BigInteger:
+					return newError("argument %d to `range` is out of range: %s", idx, arg.Inspect())
+				default:
+					return newError("argument %d to `range` must be INTEGER, got %s", idx, arg.Type())
+				}
+			}
+
+			// range(end), range(start, end) or range(start, end, step)
+			r := &object.Range{Start: 0, Step: 1}
+			switch len(bounds) {
+			case 1:
+				r.End = bounds[0]
+			case 2:
+				r.Start, r.End = bounds[0], bounds[1]
+			case 3:
+				r.Start, r.End, r.Step = bounds[0], bounds[1], bounds[2]
+			}
+
+			if r.Step == 0 {
+				return newError("`range` step must not be 0")
+			}
+			return r
+		},
+	},
 	"push": {
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 2 {
@@ -115,29 +212,82 @@ var builtins = map[string]*object.Builtin{
 	},
 }
 
+// largest result, in bits, that ** is allowed to produce for big integers
+const maxPowBits = 1 << 20
+
+// kinds seen by catch, a thrown hash can name its own with a "kind" key
+const (
+	RUNTIME_ERROR = "RuntimeError"
+	THROWN_ERROR  = "Error"
+)
+
 var (
 	TRUE       = &object.Boolean{Value: true}
 	FALSE      = &object.Boolean{Value: false}
 	NULL       = &object.Null{}
-	OPERATIONS = map[string]func(int64, int64) int64{
-		"+": func(a, b int64) int64 { return a + b },
-		"-": func(a, b int64) int64 { return a - b },
-		"*": func(a, b int64) int64 { return a * b },
-		"/": func(a, b int64) int64 { return a / b },
+	BREAK      = &object.Break{}
+	CONTINUE   = &object.Continue{}
+	OPERATIONS = map[string]func(int64, int64) (int64, bool){ // false on int64 overflow, then BIGOPERATIONS is used
+		"+": func(a, b int64) (int64, bool) {
+			c := a + b
+			return c, (a^c)&(b^c) >= 0
+		},
+		"-": func(a, b int64) (int64, bool) {
+			c := a - b
+			return c, (a^b)&(a^c) >= 0
+		},
+		"*":  mulInt64,
+		"/":  func(a, b int64) (int64, bool) { return a / b, !(a == math.MinInt64 && b == -1) },
+		"%":  func(a, b int64) (int64, bool) { return a % b, true },
+		"**": powInt64,
+	}
+	BIGOPERATIONS = map[string]func(*big.Int, *big.Int) *big.Int{
+		"+":  func(a, b *big.Int) *big.Int { return new(big.Int).Add(a, b) },
+		"-":  func(a, b *big.Int) *big.Int { return new(big.Int).Sub(a, b) },
+		"*":  func(a, b *big.Int) *big.Int { return new(big.Int).Mul(a, b) },
+		"/":  func(a, b *big.Int) *big.Int { return new(big.Int).Quo(a, b) },
+		"%":  func(a, b *big.Int) *big.Int { return new(big.Int).Rem(a, b) },
+		"**": func(a, b *big.Int) *big.Int { return new(big.Int).Exp(a, b, nil) },
 	}
 	BOOLOPERATIONS = map[string]func(int64, int64) bool{
 		">":  func(a, b int64) bool { return a > b },
 		"<":  func(a, b int64) bool { return a < b },
+		">=": func(a, b int64) bool { return a >= b },
+		"<=": func(a, b int64) bool { return a <= b },
 		"!=": func(a, b int64) bool { return a != b },
 		"==": func(a, b int64) bool { return a == b },
 	}
-	STRCOMPOPERATIONS = map[string]func(string, string) bool{
-		"!=": func(a, b string) bool { return a != b },
-		"==": func(a, b string) bool { return a == b },
+	// maps the result of object.Comparable to the value of each comparison operator
+	COMPARISONS = map[string]func(int) bool{
+		">":  func(c int) bool { return c > 0 },
+		"<":  func(c int) bool { return c < 0 },
+		">=": func(c int) bool { return c >= 0 },
+		"<=": func(c int) bool { return c <= 0 },
+		"!=": func(c int) bool { return c != 0 },
+		"==": func(c int) bool { return c == 0 },
+	}
+	FLOATOPERATIONS = map[string]func(float64, float64) float64{
+		"+":  func(a, b float64) float64 { return a + b },
+		"-":  func(a, b float64) float64 { return a - b },
+		"*":  func(a, b float64) float64 { return a * b },
+		"/":  func(a, b float64) float64 { return a / b },
+		"%":  func(a, b float64) float64 { return math.Mod(a, b) },
+		"**": func(a, b float64) float64 { return math.Pow(a, b) },
 	}
 )
 
 func Eval(node ast.Node, env *object.Enviroment) object.Object {
+	result := eval(node, env)
+
+	// the innermost node that fails gives the error its position
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+	}
+
+	return result
+}
+
+func eval(node ast.Node, env *object.Enviroment) object.Object {
 	switch node := node.(type) {
 	// statements
 	case *ast.Program:
@@ -151,17 +301,28 @@ func Eval(node ast.Node, env *object.Enviroment) object.Object {
 
 	case *ast.ReturnStatement:
 		val := Eval(node.Value, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
 		return &object.Return{Value: val}
 
 	case *ast.LetStatement:
+		if node.Name != nil && env.IsLocalConst(node.Name.Value) {
+			return newError("cannot redeclare constant: %s", node.Name.Value)
+		}
 		val := Eval(node.Value, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
-		env.Add(node.Name.Value, val)
+		if node.Pattern != nil {
+			if err := bindPattern(node.Pattern, val, env, node.Token.Type == token.CONST); err != nil {
+				return err
+			}
+		} else if node.Token.Type == token.CONST {
+			env.AddConst(node.Name.Value, val)
+		} else {
+			env.Add(node.Name.Value, val)
+		}
 
 		// expressions
 	case *ast.Identifier:
@@ -169,69 +330,117 @@ func Eval(node ast.Node, env *object.Enviroment) object.Object {
 	case *ast.IfStatement:
 		return evalIfStatement(node, env)
 
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+
+	case *ast.BreakStatement:
+		return BREAK
+
+	case *ast.ContinueStatement:
+		return CONTINUE
+
+	case *ast.TryStatement:
+		return evalTryStatement(node, env)
+
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		return newThrownError(val)
+
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return evalPrefixExpression(node.Operator, right, env)
 
 	case *ast.InfixExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
+		if node.Operator == "&&" || node.Operator == "||" || node.Operator == "??" {
+			return evalLogicalExpression(left, node.Operator, node.Right, env)
+		}
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
-		return evalInfixExpression(left, node.Operator, right)
+		return evalInfixExpression(left, node.Operator, right, env)
+
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
+
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
+
+	case *ast.SpreadExpression:
+		return newError("unexpected spread: %s", node.String())
+
+	case *ast.ConditionalExpression:
+		condition := Eval(node.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+		if isTruthy(condition) {
+			return Eval(node.Consequence, env)
+		}
+		return Eval(node.Alternative, env)
 
 	case *ast.CallExpression:
 		function := Eval(node.Function, env)
-		if isError(function) {
+		if isAbrupt(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
-
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
+		args, kwargs, err := evalCallArguments(node.Arguments, env)
+		if err != nil {
+			return err
 		}
 
-		return applyFunction(function, args)
+		return applyFunction(function, args, kwargs, node.Pos())
 
 	case *ast.FunctionLiteral:
 		params := node.Arguments
 		body := node.Body
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		return &object.Function{Name: node.Name, Parameters: params, Body: body, Env: env}
+
+	case *ast.FunctionDeclaration:
+		// already bound by hoistFunctions when its block started
+		return nil
 
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return object.NewBigInteger(node.Big)
+		}
 		return &object.Integer{Value: node.Value}
 
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
 	case *ast.Boolean:
 		return nativeBoolToObj(node.Value)
 
+	case *ast.NullLiteral:
+		return NULL
+
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 
 	case *ast.ArrayLiteral:
 		e := evalExpressions(node.Elements, env)
-		if len(e) == 1 && isError(e[0]) {
+		if len(e) == 1 && isAbrupt(e[0]) {
 			return e[0]
 		}
 		return &object.Array{Elements: e}
 
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
-			return left
-		}
-
-		i := Eval(node.Index, env)
-		if isError(i) {
-			return i
-		}
-		return evalIndexExpression(left, i)
+		val, _ := evalIndexChain(node, env)
+		return val
 
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
@@ -241,6 +450,10 @@ func Eval(node ast.Node, env *object.Enviroment) object.Object {
 }
 
 func evalProgram(p *ast.Program, env *object.Enviroment) object.Object {
+	if err := hoistFunctions(p.Statements, env); err != nil {
+		return err
+	}
+
 	var result object.Object
 
 	for _, st := range p.Statements {
@@ -251,6 +464,8 @@ func evalProgram(p *ast.Program, env *object.Enviroment) object.Object {
 			return result.Value
 		case *object.Error:
 			return result
+		case *object.Break, *object.Continue:
+			return newError("%s outside loop", result.Inspect())
 		}
 	}
 
@@ -258,6 +473,10 @@ func evalProgram(p *ast.Program, env *object.Enviroment) object.Object {
 }
 
 func evalBlockStatement(block *ast.BlockStatement, env *object.Enviroment) object.Object {
+	if err := hoistFunctions(block.Statements, env); err != nil {
+		return err
+	}
+
 	var result object.Object
 
 	for _, st := range block.Statements {
@@ -265,7 +484,7 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Enviroment) objec
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return result
 			}
 		}
@@ -274,6 +493,31 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Enviroment) objec
 	return result
 }
 
+// binds the function declarations of a block before it runs, so they can call each other in any order
+func hoistFunctions(statements []ast.Statement, env *object.Enviroment) *object.Error {
+	// constants of the same block are not bound yet, but would clash with the function later
+	constants := map[string]bool{}
+	for _, st := range statements {
+		if let, ok := st.(*ast.LetStatement); ok && let.Token.Type == token.CONST && let.Name != nil {
+			constants[let.Name.Value] = true
+		}
+	}
+
+	for _, st := range statements {
+		fd, ok := st.(*ast.FunctionDeclaration)
+		if !ok {
+			continue
+		}
+		if env.IsLocalConst(fd.Name.Value) || constants[fd.Name.Value] {
+			err := newError("cannot redeclare constant: %s", fd.Name.Value)
+			err.Pos = fd.Pos()
+			return err
+		}
+		env.Add(fd.Name.Value, Eval(fd.Function, env))
+	}
+	return nil
+}
+
 func evalIdentifier(node *ast.Identifier, env *object.Enviroment) object.Object {
 	if val, ok := env.Value(node.Value); ok {
 		return val
@@ -286,12 +530,130 @@ func evalIdentifier(node *ast.Identifier, env *object.Enviroment) object.Object
 	return newError("identifier not found: " + node.Value)
 }
 
+func evalAssignExpression(node *ast.AssignExpression, env *object.Enviroment) object.Object {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		return evalIdentifierAssign(target, node, env)
+	case *ast.IndexExpression:
+		return evalIndexAssign(target, node, env)
+	default:
+		return newError("cannot assign to %s", node.Target.String())
+	}
+}
+
+func evalIdentifierAssign(ident *ast.Identifier, node *ast.AssignExpression, env *object.Enviroment) object.Object {
+	if env.IsConst(ident.Value) {
+		return newError("cannot assign to constant: %s", ident.Value)
+	}
+
+	// compound assignment reads the current value before evaluating the right side
+	var current object.Object
+	if node.Operator != "=" {
+		var ok bool
+		if current, ok = env.Value(ident.Value); !ok {
+			return newError("assignment to undeclared variable: %s", ident.Value)
+		}
+	}
+
+	val := evalAssignedValue(node, current, env)
+	if isAbrupt(val) {
+		return val
+	}
+
+	if _, ok := env.Set(ident.Value, val); !ok {
+		return newError("assignment to undeclared variable: %s", ident.Value)
+	}
+	return val
+}
+
+func evalIndexAssign(target *ast.IndexExpression, node *ast.AssignExpression, env *object.Enviroment) object.Object {
+	left := Eval(target.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+
+	index := Eval(target.Index, env)
+	if isAbrupt(index) {
+		return index
+	}
+
+	if err := checkIndexAssign(left, index); err != nil {
+		return err
+	}
+
+	var current object.Object
+	if node.Operator != "=" {
+		if hash, ok := left.(*object.Hash); ok {
+			pair, ok := hash.Pairs[index.(object.Hashable).HashKey()]
+			if !ok {
+				return newError("key not found: %s", index.Inspect())
+			}
+			current = pair.Value
+		} else {
+			current = evalIndexExpression(left, index)
+		}
+	}
+
+	val := evalAssignedValue(node, current, env)
+	if isAbrupt(val) {
+		return val
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		left.Elements[index.(*object.Integer).Value] = val
+	case *object.Hash:
+		left.Pairs[index.(object.Hashable).HashKey()] = object.HashPair{Key: index, Value: val}
+	}
+	return val
+}
+
+// checks that left[index] can be assigned, arrays only accept indexes that already exist
+func checkIndexAssign(left, index object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		if index.Type() != object.INTEGER_OBJ {
+			return newError("array index must be INTEGER, got %s", index.Type())
+		}
+		idx, ok := index.(*object.Integer)
+		if !ok || idx.Value < 0 || idx.Value >= int64(len(left.Elements)) {
+			return newError("index out of range: %s with length %d", index.Inspect(), len(left.Elements))
+		}
+	case *object.Hash:
+		if _, ok := index.(object.Hashable); !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+	return nil
+}
+
+// evaluates the right side of an assignment and applies the operator of compound assignments to current
+func evalAssignedValue(node *ast.AssignExpression, current object.Object, env *object.Enviroment) object.Object {
+	val := Eval(node.Value, env)
+	if isAbrupt(val) || current == nil {
+		return val
+	}
+	return evalInfixExpression(current, strings.TrimSuffix(node.Operator, "="), val, env)
+}
+
+// ...value elements are expanded in place
 func evalExpressions(expressions []ast.Expression, env *object.Enviroment) []object.Object {
 	var res []object.Object
 
 	for _, e := range expressions {
+		if spread, ok := e.(*ast.SpreadExpression); ok {
+			elements, err := evalSpread(spread, env)
+			if err != nil {
+				return []object.Object{err}
+			}
+			res = append(res, elements...)
+			continue
+		}
+
 		evaluated := Eval(e, env)
-		if isError(evaluated) {
+		if isAbrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
 		res = append(res, evaluated)
@@ -299,49 +661,216 @@ func evalExpressions(expressions []ast.Expression, env *object.Enviroment) []obj
 	return res
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// elements of the array that ...value expands to
+func evalSpread(spread *ast.SpreadExpression, env *object.Enviroment) ([]object.Object, object.Object) {
+	val := Eval(spread.Value, env)
+	if isAbrupt(val) {
+		return nil, val
+	}
+
+	arr, ok := val.(*object.Array)
+	if !ok {
+		return nil, newError("cannot spread %s", val.Type())
+	}
+	return arr.Elements, nil
+}
+
+// positional arguments of a call and its keyword arguments by name
+// the parser only allows keyword arguments after the positional ones, so both are evaluated in source order
+func evalCallArguments(arguments []ast.Expression, env *object.Enviroment) ([]object.Object, map[string]object.Object, object.Object) {
+	positional := []ast.Expression{}
+	keywords := []*ast.KeywordArgument{}
+	for _, arg := range arguments {
+		if kw, ok := arg.(*ast.KeywordArgument); ok {
+			keywords = append(keywords, kw)
+		} else {
+			positional = append(positional, arg)
+		}
+	}
+
+	args := evalExpressions(positional, env)
+	if len(args) == 1 && isAbrupt(args[0]) {
+		return nil, nil, args[0]
+	}
+
+	var kwargs map[string]object.Object
+	for _, kw := range keywords {
+		if kwargs == nil {
+			kwargs = make(map[string]object.Object)
+		}
+		if _, ok := kwargs[kw.Name.Value]; ok {
+			return nil, nil, newError("keyword argument repeated: %s", kw.Name.Value)
+		}
+
+		val := Eval(kw.Value, env)
+		if isAbrupt(val) {
+			return nil, nil, val
+		}
+		kwargs[kw.Name.Value] = val
+	}
+
+	return args, kwargs, nil
+}
+
+// pos is the call site, added to the trace of errors that leave the body of fn
+func applyFunction(fn object.Object, args []object.Object, kwargs map[string]object.Object, pos token.Position) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		extendedEnv := extendedFunctionEnv(fn, args)
+		extendedEnv, err := extendedFunctionEnv(fn, args, kwargs)
+		if err != nil {
+			return err
+		}
 		evaluated := Eval(fn.Body, extendedEnv)
+		if err, ok := evaluated.(*object.Error); ok {
+			err.Trace = append(err.Trace, object.Frame{Function: fn.Name, Pos: pos})
+		}
 		return unwrapedReturnValue(evaluated)
 	case *object.Builtin:
+		if len(kwargs) > 0 {
+			return newError("builtin functions do not take keyword arguments")
+		}
 		return fn.Fn(args...)
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
-func extendedFunctionEnv(fn *object.Function, args []object.Object) *object.Enviroment {
+// binds the arguments of a call to the parameters of fn, in a new scope enclosed by the scope fn was defined in
+// a parameter takes its positional argument, then its keyword argument, then its default value
+func extendedFunctionEnv(fn *object.Function, args []object.Object, kwargs map[string]object.Object) (*object.Enviroment, *object.Error) {
 	env := object.NewEnclosedEnviroment(fn.Env)
+
+	minArgs, maxArgs := arity(fn)
+	if maxArgs >= 0 && len(args) > maxArgs {
+		return nil, arityError(len(args), minArgs, maxArgs)
+	}
+
+	usedKwargs := 0
 	for idx, param := range fn.Parameters {
-		env.Add(param.Value, args[idx])
+		pattern, name, defaultValue := param, parameterName(param), ast.Expression(nil)
+		switch param := param.(type) {
+		case *ast.SpreadExpression:
+			rest := []object.Object{}
+			if idx < len(args) {
+				rest = append(rest, args[idx:]...)
+			}
+			env.Add(param.Value.String(), &object.Array{Elements: rest})
+			continue
+		case *ast.AssignExpression:
+			pattern, defaultValue = param.Target, param.Value
+		}
+
+		kwarg, hasKwarg := kwargs[name]
+		if hasKwarg {
+			usedKwargs += 1
+		}
+
+		var val object.Object
+		switch {
+		case idx < len(args) && hasKwarg:
+			return nil, newError("multiple values for argument: %s", name)
+		case idx < len(args):
+			val = args[idx]
+		case hasKwarg:
+			val = kwarg
+		case defaultValue != nil:
+			// defaults are evaluated at call time and can use the parameters before them
+			val = Eval(defaultValue, env)
+			if err, ok := val.(*object.Error); ok {
+				return nil, err
+			}
+		case len(kwargs) == 0:
+			return nil, arityError(len(args), minArgs, maxArgs)
+		default:
+			return nil, newError("missing argument for parameter %s", param.String())
+		}
+
+		if err := bindPattern(pattern, val, env, false); err != nil {
+			return nil, newError("argument %d: %s", idx, err.Value)
+		}
 	}
-	return env
+
+	if usedKwargs != len(kwargs) {
+		names := slices.Sorted(maps.Keys(kwargs))
+		for _, name := range names {
+			if !slices.ContainsFunc(fn.Parameters, func(param ast.Expression) bool { return parameterName(param) == name }) {
+				return nil, newError("unexpected keyword argument: %s", name)
+			}
+		}
+	}
+
+	return env, nil
+}
+
+// number of positional arguments fn accepts, max is -1 when fn has a rest parameter
+func arity(fn *object.Function) (minArgs, maxArgs int) {
+	for _, param := range fn.Parameters {
+		switch param.(type) {
+		case *ast.SpreadExpression:
+			return minArgs, -1
+		case *ast.AssignExpression:
+			maxArgs += 1
+		default:
+			minArgs += 1
+			maxArgs += 1
+		}
+	}
+	return minArgs, maxArgs
+}
+
+func arityError(got, minArgs, maxArgs int) *object.Error {
+	switch {
+	case maxArgs < 0:
+		return newError("wrong number of arguments. got=%d, want at least %d", got, minArgs)
+	case minArgs != maxArgs:
+		return newError("wrong number of arguments. got=%d, want=%d to %d", got, minArgs, maxArgs)
+	default:
+		return newError("wrong number of arguments. got=%d, want=%d", got, minArgs)
+	}
+}
+
+// name a keyword argument can use to pass a value to param, empty for patterns and rest parameters
+func parameterName(param ast.Expression) string {
+	switch param := param.(type) {
+	case *ast.Identifier:
+		return param.Value
+	case *ast.AssignExpression:
+		return param.Target.String()
+	}
+	return ""
 }
 
 func unwrapedReturnValue(obj object.Object) object.Object {
-	if ret, ok := obj.(*object.Return); ok {
-		return ret.Value
+	switch obj := obj.(type) {
+	case *object.Return:
+		return obj.Value
+	case *object.Break, *object.Continue:
+		// loops do not cross function boundaries
+		return newError("%s outside loop", obj.Inspect())
 	}
 	return obj
 }
 
-func evalPrefixExpression(operator string, right object.Object) object.Object {
+func evalPrefixExpression(operator string, right object.Object, env *object.Enviroment) object.Object {
 	switch operator {
 	case "!":
 		return evalBangOperatorExpression(right)
 	case "-":
-		return evalMinusOperatorExpression(right)
+		return evalMinusOperatorExpression(right, env)
 	default:
 		return newError("unknown operator: %s%s", operator, right.Type())
 	}
 }
 
-func evalInfixExpression(left object.Object, operator string, right object.Object) object.Object {
+func evalInfixExpression(left object.Object, operator string, right object.Object, env *object.Enviroment) object.Object {
 	switch {
+	// null is only equal to itself, it never matches a falsy value like 0 or false
+	case (left == NULL || right == NULL) && (operator == "==" || operator == "!="):
+		return nativeBoolToObj((left == right) == (operator == "=="))
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-		return evalIntegerInfixExpression(left, operator, right)
+		return evalIntegerInfixExpression(left, operator, right, env)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(left, operator, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(left, operator, right)
 	case operator == "==":
@@ -355,6 +884,25 @@ func evalInfixExpression(left object.Object, operator string, right object.Objec
 	}
 }
 
+// the right side is only evaluated when the left side does not decide the result
+// && and || produce booleans, ?? produces the left side unless it is null
+func evalLogicalExpression(left object.Object, operator string, rightNode ast.Expression, env *object.Enviroment) object.Object {
+	switch {
+	case operator == "&&" && !isTruthy(left):
+		return FALSE
+	case operator == "||" && isTruthy(left):
+		return TRUE
+	case operator == "??" && left != NULL:
+		return left
+	}
+
+	right := Eval(rightNode, env)
+	if isAbrupt(right) || operator == "??" {
+		return right
+	}
+	return nativeBoolToObj(isTruthy(right))
+}
+
 func evalBangOperatorExpression(right object.Object) object.Object {
 	switch right {
 	case TRUE:
@@ -368,13 +916,62 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 	}
 }
 
-func evalIntegerInfixExpression(left object.Object, operator string, right object.Object) object.Object {
-	valueLeft := left.(*object.Integer).Value
-	valueRight := right.(*object.Integer).Value
-	if fn, ok := OPERATIONS[operator]; ok {
-		return &object.Integer{Value: fn(valueLeft, valueRight)}
-	} else if fn, ok := BOOLOPERATIONS[operator]; ok {
-		return nativeBoolToObj(fn(valueLeft, valueRight))
+func evalIntegerInfixExpression(left object.Object, operator string, right object.Object, env *object.Enviroment) object.Object {
+	if err := checkArithmetic(left, operator, right); err != nil {
+		return err
+	}
+
+	intLeft, okLeft := left.(*object.Integer)
+	intRight, okRight := right.(*object.Integer)
+
+	// fast path, both operands fit in an int64
+	if okLeft && okRight {
+		valueLeft := intLeft.Value
+		valueRight := intRight.Value
+		if fn, ok := OPERATIONS[operator]; ok {
+			if res, ok := fn(valueLeft, valueRight); ok {
+				return &object.Integer{Value: res}
+			} else if env.CheckedArithmetic() {
+				return newError("integer overflow: %s %s %s", left.Inspect(), operator, right.Inspect())
+			}
+		} else if fn, ok := BOOLOPERATIONS[operator]; ok {
+			return nativeBoolToObj(fn(valueLeft, valueRight))
+		}
+	}
+
+	return evalBigIntegerInfixExpression(left, operator, right, env)
+}
+
+// slow path for operands that are BigIntegers or results that overflow an int64
+func evalBigIntegerInfixExpression(left object.Object, operator string, right object.Object, env *object.Enviroment) object.Object {
+	valueLeft := toBig(left)
+	valueRight := toBig(right)
+	if operator == "**" && powTooLarge(valueLeft, valueRight) {
+		return newError("integer overflow: %s ** %s is too large", left.Inspect(), right.Inspect())
+	}
+	if fn, ok := BIGOPERATIONS[operator]; ok {
+		res := object.NewBigInteger(fn(valueLeft, valueRight))
+		if _, isBig := res.(*object.BigInteger); isBig && env.CheckedArithmetic() {
+			return newError("integer overflow: %s %s %s", left.Inspect(), operator, right.Inspect())
+		}
+		return res
+	} else if _, ok := COMPARISONS[operator]; ok {
+		return evalComparison(left, operator, right)
+	}
+
+	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+}
+
+// at least one of the operands is a float, so both are converted to float
+func evalFloatInfixExpression(left object.Object, operator string, right object.Object) object.Object {
+	if err := checkArithmetic(left, operator, right); err != nil {
+		return err
+	}
+
+	if fn, ok := FLOATOPERATIONS[operator]; ok {
+		return &object.Float{Value: fn(toFloat(left), toFloat(right))}
+	} else if _, ok := COMPARISONS[operator]; ok {
+		return evalComparison(left, operator, right)
 	}
 
 	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
@@ -383,8 +980,8 @@ func evalIntegerInfixExpression(left object.Object, operator string, right objec
 func evalStringInfixExpression(left object.Object, operator string, right object.Object) object.Object {
 	valueLeft := left.(*object.String).Value
 	valueRight := right.(*object.String).Value
-	if fn, ok := STRCOMPOPERATIONS[operator]; ok {
-		return nativeBoolToObj(fn(valueLeft, valueRight))
+	if _, ok := COMPARISONS[operator]; ok {
+		return evalComparison(left, operator, right)
 	} else if operator == "+" {
 		return &object.String{Value: valueLeft + valueRight}
 	}
@@ -392,25 +989,374 @@ func evalStringInfixExpression(left object.Object, operator string, right object
 	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 }
 
-func evalMinusOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
-		return newError("unknown operator: -%s", right.Type())
+// compares two objects with the object.Comparable protocol, the operator must be in COMPARISONS
+func evalComparison(left object.Object, operator string, right object.Object) object.Object {
+	c, ok := compareObjects(left, right)
+	if !ok {
+		// unordered values, like NaN, are only different from everything
+		return nativeBoolToObj(operator == "!=")
 	}
+	return nativeBoolToObj(COMPARISONS[operator](c))
+}
 
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+// orders two objects, ok is false when they can not be ordered
+// shared by comparison operators and builtins that need to sort
+func compareObjects(left, right object.Object) (int, bool) {
+	cmp, ok := left.(object.Comparable)
+	if !ok {
+		return 0, false
+	}
+	return cmp.Compare(right)
+}
+
+func evalMinusOperatorExpression(right object.Object, env *object.Enviroment) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		if right.Value == math.MinInt64 {
+			if env.CheckedArithmetic() {
+				return newError("integer overflow: -%s", right.Inspect())
+			}
+			return object.NewBigInteger(new(big.Int).Neg(toBig(right)))
+		}
+		return &object.Integer{Value: -right.Value}
+	case *object.BigInteger:
+		return object.NewBigInteger(new(big.Int).Neg(right.Value))
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
+		return newError("unknown operator: -%s", right.Type())
+	}
 }
 
 func evalIfStatement(node *ast.IfStatement, env *object.Enviroment) object.Object {
 	condition := Eval(node.Condition, env)
+	if isAbrupt(condition) {
+		return condition
+	}
 
+	var result object.Object
 	if isTruthy(condition) {
-		return Eval(node.Consequence, env)
+		result = Eval(node.Consequence, blockEnv(env))
 	} else if node.Alternative != nil {
-		return Eval(node.Alternative, env)
-	} else {
+		result = Eval(node.Alternative, blockEnv(env))
+	}
+
+	// a branch that is empty or ends with a let has no value
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+// scope for the bindings made inside a block, they end with the block
+// unless the run asked for the old scoping with SetLegacyBlockScope
+func blockEnv(env *object.Enviroment) *object.Enviroment {
+	if env.LegacyBlockScope() {
+		return env
+	}
+	return object.NewEnclosedEnviroment(env)
+}
+
+// the first arm whose pattern matches and whose guard holds is evaluated
+// every arm binds its identifiers in its own scope, so a failed arm doesn't leak bindings
+func evalMatchExpression(node *ast.MatchExpression, env *object.Enviroment) object.Object {
+	subject := Eval(node.Subject, env)
+	if isAbrupt(subject) {
+		return subject
+	}
+
+	for _, arm := range node.Arms {
+		armEnv := object.NewEnclosedEnviroment(env)
+		if !matchPattern(arm.Pattern, subject, armEnv) {
+			continue
+		}
+
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, armEnv)
+			if isAbrupt(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+
+		if result := Eval(arm.Body, armEnv); result != nil {
+			return result
+		}
 		return NULL
 	}
+
+	return newError("no match for %s", subject.Inspect())
+}
+
+// reports whether val has the shape of pattern, binding the identifiers of pattern in env
+func matchPattern(pattern ast.Expression, val object.Object, env *object.Enviroment) bool {
+	return bindPattern(pattern, val, env, false) == nil
+}
+
+// binds the identifiers of pattern to the matching parts of val in env
+// returns an error describing the first part of val that does not have the shape of pattern
+func bindPattern(pattern ast.Expression, val object.Object, env *object.Enviroment, constant bool) *object.Error {
+	switch pt := pattern.(type) {
+	case *ast.Identifier:
+		if pt.Value == "_" {
+			return nil
+		}
+		if env.IsLocalConst(pt.Value) {
+			return newError("cannot redeclare constant: %s", pt.Value)
+		}
+		if constant {
+			env.AddConst(pt.Value, val)
+		} else {
+			env.Add(pt.Value, val)
+		}
+		return nil
+
+	case *ast.ArrayLiteral:
+		arr, ok := val.(*object.Array)
+		if !ok {
+			return newError("cannot destructure %s as ARRAY", val.Type())
+		}
+
+		elements := pt.Elements
+		var rest *ast.SpreadExpression
+		if n := len(elements); n > 0 {
+			if rest, ok = elements[n-1].(*ast.SpreadExpression); ok {
+				elements = elements[:n-1]
+			}
+		}
+
+		if rest != nil && len(arr.Elements) < len(elements) {
+			return newError("expected at least %d elements, got %d", len(elements), len(arr.Elements))
+		}
+		if rest == nil && len(arr.Elements) != len(elements) {
+			return newError("expected %d elements, got %d", len(elements), len(arr.Elements))
+		}
+		for i, el := range elements {
+			if err := bindPattern(el, arr.Elements[i], env, constant); err != nil {
+				return err
+			}
+		}
+		if rest != nil {
+			// the rest gets its own copy, arrays are mutable
+			tail := make([]object.Object, len(arr.Elements)-len(elements))
+			copy(tail, arr.Elements[len(elements):])
+			return bindPattern(rest.Value, &object.Array{Elements: tail}, env, constant)
+		}
+		return nil
+
+	case *ast.HashLiteral:
+		hash, ok := val.(*object.Hash)
+		if !ok {
+			return newError("cannot destructure %s as HASH", val.Type())
+		}
+
+		for k, v := range pt.Pairs {
+			key := Eval(k, env)
+			hashKey, ok := key.(object.Hashable)
+			if !ok {
+				return newError("unusable as hash key: %s", key.Type())
+			}
+			pair, ok := hash.Pairs[hashKey.HashKey()]
+			if !ok {
+				return newError("key not found: %s", key.Inspect())
+			}
+			if err := bindPattern(v, pair.Value, env, constant); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		// literals match values that are equal to them
+		if evalInfixExpression(Eval(pattern, env), "==", val, env) != TRUE {
+			return newError("pattern %s does not match %s", pattern.String(), val.Inspect())
+		}
+		return nil
+	}
+}
+
+func evalWhileStatement(node *ast.WhileStatement, env *object.Enviroment) object.Object {
+	for {
+		condition := Eval(node.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		// every iteration gets a fresh scope, like the loop variables of for
+		if result, done := loopBody(Eval(node.Body, blockEnv(env))); done {
+			return result
+		}
+	}
+}
+
+func evalForStatement(node *ast.ForStatement, env *object.Enviroment) object.Object {
+	iterable := Eval(node.Iterable, env)
+	if isAbrupt(iterable) {
+		return iterable
+	}
+
+	it, ok := iterable.(object.Iterable)
+	if !ok {
+		return newError("cannot iterate over %s", iterable.Type())
+	}
+
+	iter := it.Iterator()
+	for {
+		key, value, ok := iter.Next()
+		if !ok {
+			return NULL
+		}
+
+		// every iteration gets its own bindings, so closures capture the current element
+		loopEnv := object.NewEnclosedEnviroment(env)
+		switch {
+		case node.Key != nil:
+			loopEnv.Add(node.Key.Value, key)
+			loopEnv.Add(node.Value.Value, value)
+		case iterable.Type() == object.HASH_OBJ:
+			// a single variable walks the keys of a hash
+			loopEnv.Add(node.Value.Value, key)
+		default:
+			loopEnv.Add(node.Value.Value, value)
+		}
+
+		if result, done := loopBody(Eval(node.Body, loopEnv)); done {
+			return result
+		}
+	}
+}
+
+// runs the block, then catch when the block fails with an error, then finally in every case
+func evalTryStatement(node *ast.TryStatement, env *object.Enviroment) object.Object {
+	result := Eval(node.Block, blockEnv(env))
+
+	if err, ok := result.(*object.Error); ok && node.Catch != nil {
+		catchEnv := object.NewEnclosedEnviroment(env)
+		if node.Param != nil {
+			catchEnv.Add(node.Param.Value, errorHash(err))
+		}
+		result = Eval(node.Catch, catchEnv)
+	}
+
+	if node.Finally != nil {
+		// an error, return, break or continue inside finally wins over the result of the block and catch
+		if fin := Eval(node.Finally, blockEnv(env)); isError(fin) || isControlSignal(fin) {
+			return fin
+		}
+	}
+
+	return result
+}
+
+// error for throw, strings are the message, hashes can carry their own message and kind
+func newThrownError(val object.Object) *object.Error {
+	err := &object.Error{Value: val.Inspect(), Kind: THROWN_ERROR, Thrown: val}
+
+	switch val := val.(type) {
+	case *object.String:
+		err.Value = val.Value
+	case *object.Hash:
+		if msg, ok := hashString(val, "message"); ok {
+			err.Value = msg
+		}
+		if kind, ok := hashString(val, "kind"); ok {
+			err.Kind = kind
+		}
+	}
+
+	return err
+}
+
+func hashString(hash *object.Hash, key string) (string, bool) {
+	pair, ok := hash.Pairs[(&object.String{Value: key}).HashKey()]
+	if !ok {
+		return "", false
+	}
+	str, ok := pair.Value.(*object.String)
+	if !ok {
+		return "", false
+	}
+	return str.Value, true
+}
+
+// what catch (e) binds: message, kind, line, column and the thrown value, null when missing
+func errorHash(err *object.Error) *object.Hash {
+	var line, column, value object.Object = NULL, NULL, NULL
+	if err.Pos.IsValid() {
+		line = &object.Integer{Value: int64(err.Pos.Line)}
+		column = &object.Integer{Value: int64(err.Pos.Column)}
+	}
+	if err.Thrown != nil {
+		value = err.Thrown
+	}
+
+	hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair)}
+	for key, val := range map[string]object.Object{
+		"message": &object.String{Value: err.Value},
+		"kind":    &object.String{Value: err.Kind},
+		"line":    line,
+		"column":  column,
+		"value":   value,
+	} {
+		k := &object.String{Value: key}
+		hash.Pairs[k.HashKey()] = object.HashPair{Key: k, Value: val}
+	}
+	return hash
+}
+
+// reports whether obj is a return, break or continue signal, which leaves the enclosing expressions like an error does
+func isControlSignal(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Return, *object.Break, *object.Continue:
+		return true
+	}
+	return false
+}
+
+// handles the result of one loop iteration, done is true when the loop must stop and return result
+func loopBody(result object.Object) (object.Object, bool) {
+	if result == nil {
+		return nil, false
+	}
+
+	switch result.Type() {
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+		return result, true
+	case object.BREAK_OBJ:
+		return NULL, true
+	}
+	return nil, false
+}
+
+// evaluates a[b]?.c[d], once an optional access gives null the rest of the chain is null too
+// skipped is true when that happened, so the outer links of the chain are skipped as well
+func evalIndexChain(node *ast.IndexExpression, env *object.Enviroment) (val object.Object, skipped bool) {
+	var left object.Object
+	if inner, ok := node.Left.(*ast.IndexExpression); ok {
+		left, skipped = evalIndexChain(inner, env)
+	} else {
+		left = Eval(node.Left, env)
+	}
+	if isAbrupt(left) {
+		return left, false
+	}
+	if skipped || (node.Optional && left == NULL) {
+		return NULL, true
+	}
+
+	i := Eval(node.Index, env)
+	if isAbrupt(i) {
+		return i, false
+	}
+
+	val = evalIndexExpression(left, i)
+	return val, node.Optional && val == NULL
 }
 
 func evalIndexExpression(left, index object.Object) object.Object {
@@ -426,7 +1372,12 @@ func evalIndexExpression(left, index object.Object) object.Object {
 
 func evalArrayIndexExpression(arr, index object.Object) object.Object {
 	a := arr.(*object.Array)
-	i := index.(*object.Integer).Value
+	idx, ok := index.(*object.Integer)
+	if !ok {
+		// a BigInteger is always out of range
+		return NULL
+	}
+	i := idx.Value
 
 	maxIndex := int64(len(a.Elements) - 1)
 	if i < 0 || i > maxIndex {
@@ -441,8 +1392,8 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Enviroment) object.Objec
 
 	for k, v := range node.Pairs {
 		key := Eval(k, env)
-		if isError(key) {
-			return nil
+		if isAbrupt(key) {
+			return key
 		}
 
 		hashKey, ok := key.(object.Hashable)
@@ -451,8 +1402,8 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Enviroment) object.Objec
 		}
 
 		value := Eval(v, env)
-		if isError(value) {
-			return nil
+		if isAbrupt(value) {
+			return value
 		}
 
 		hashed := hashKey.HashKey()
@@ -476,6 +1427,102 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 	return pair.Value
 }
 
+func mulInt64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	c := a * b
+	return c, c/b == a && !(a == -1 && b == math.MinInt64) && !(b == -1 && a == math.MinInt64)
+}
+
+// exponentiation by squaring, b is not negative
+func powInt64(a, b int64) (int64, bool) {
+	res := int64(1)
+	for b > 0 {
+		var ok bool
+		if b&1 == 1 {
+			if res, ok = mulInt64(res, a); !ok {
+				return 0, false
+			}
+		}
+		b >>= 1
+		if b > 0 {
+			if a, ok = mulInt64(a, a); !ok {
+				return 0, false
+			}
+		}
+	}
+	return res, true
+}
+
+// reports faults that would otherwise panic the host process or produce garbage
+func checkArithmetic(left object.Object, operator string, right object.Object) *object.Error {
+	switch operator {
+	case "/", "%":
+		if isZero(right) {
+			return newError("division by zero: %s %s %s", left.Inspect(), operator, right.Inspect())
+		}
+	case "**":
+		if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ && toBig(right).Sign() < 0 {
+			return newError("negative exponent: %s ** %s", left.Inspect(), right.Inspect())
+		}
+	}
+	return nil
+}
+
+// reports if a ** b would need more than maxPowBits, a and b are not negative
+func powTooLarge(a, b *big.Int) bool {
+	if a.CmpAbs(big.NewInt(1)) <= 0 {
+		return false
+	}
+	if !b.IsInt64() || b.Int64() > maxPowBits {
+		return true
+	}
+	return int64(a.BitLen())*b.Int64() > maxPowBits
+}
+
+func isZero(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value == 0
+	case *object.Float:
+		return obj.Value == 0
+	default:
+		return false
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// converts a number to float64, obj must satisfy isNumber
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.BigInteger:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f
+	case *object.Float:
+		return obj.Value
+	default:
+		return math.NaN()
+	}
+}
+
+// converts an integer to *big.Int, obj must be an Integer or a BigInteger
+func toBig(obj object.Object) *big.Int {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return big.NewInt(obj.Value)
+	case *object.BigInteger:
+		return obj.Value
+	default:
+		return new(big.Int)
+	}
+}
+
 func nativeBoolToObj(b bool) *object.Boolean {
 	if b {
 		return TRUE
@@ -497,7 +1544,7 @@ func isTruthy(obj object.Object) bool {
 }
 
 func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Value: fmt.Sprintf(format, a...)}
+	return &object.Error{Value: fmt.Sprintf(format, a...), Kind: RUNTIME_ERROR}
 }
 
 func isError(obj object.Object) bool {
@@ -506,3 +1553,9 @@ func isError(obj object.Object) bool {
 	}
 	return false
 }
+
+// errors, return, break and continue stop the evaluation of the expression they appear in
+// and are passed up, like a break inside an if expression that is an argument of a call
+func isAbrupt(obj object.Object) bool {
+	return isError(obj) || isControlSignal(obj)
+}
@@ -1,6 +1,7 @@
 package eval
 
 import (
+	"math"
 	"slices"
 	"testing"
 
@@ -30,19 +31,235 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
 	}
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testIntegerObject(t, evaluated, tt.expected)
 	}
 }
 
-func testEval(input string) object.Object {
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"1.5", 1.5},
+		{"-2.5", -2.5},
+		{"1e3", 1000},
+		{"0.1 + 0.2 * 2", 0.5},
+		{"7 / 2.0", 3.5},
+		{"1 + 0.5", 1.5},
+		{"(1 + 2 + 3) / 4.0", 1.5},
+		{"float(3) / 2", 1.5},
+		{`float("2.25")`, 2.25},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testFloatObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"4294967296 * 4294967296", "18446744073709551616"},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"123456789012345678901234567890", "123456789012345678901234567890"},
+		{"123456789012345678901234567890 / 10", "12345678901234567890123456789"},
+		{`int("100000000000000000000")`, "100000000000000000000"},
+		{"int(1e20)", "100000000000000000000"},
+		{`let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(25)`, "15511210043330985984000000"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		result, ok := evaluated.(*object.BigInteger)
+		if !ok {
+			t.Errorf("object is not BigInteger. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("object has wrong value. got=%s, want=%s", result.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestBigIntegerDemotion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"(9223372036854775807 + 10) - 20", 9223372036854775797},
+		{"100000000000000000000 / 100000000000000000000", 1},
+		{"100000000000000000000 > 9223372036854775807", true},
+		{"100000000000000000000 == 100000000000000000000", true},
+		{"-100000000000000000000 < 1", true},
+		{"100000000000000000000 / 1e20", 1.0},
+		{"[1, 2, 3][100000000000000000000]", nil},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestModuloAndPower(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"(2 ** 3) ** 2", 64},
+		{"-2 ** 2", 4},
+		{"3 * 2 ** 2", 12},
+		{"5 ** 0", 1},
+		{"2 ** -1.0", 0.5},
+		{"7.5 % 2", 1.5},
+		{"9 ** 0.5", 3.0},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		}
+	}
+
+	evaluated := testEval(t, "2 ** 100")
+	if evaluated.Inspect() != "1267650600228229401496703205376" {
+		t.Errorf("2 ** 100 wrong. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestArithmeticErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 / 0", "division by zero: 1 / 0"},
+		{"1 % 0", "division by zero: 1 % 0"},
+		{"1.5 / 0", "division by zero: 1.5 / 0"},
+		{"1 / 0.0", "division by zero: 1 / 0.0"},
+		{"100000000000000000000 / 0", "division by zero: 100000000000000000000 / 0"},
+		{"let f = fn(x) { 10 / x }; f(0)", "division by zero: 10 / 0"},
+		{"2 ** -1", "negative exponent: 2 ** -1"},
+		{"2 ** 100000000", "integer overflow: 2 ** 100000000 is too large"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testErrorObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestCheckedArithmetic(t *testing.T) {
+	checked := func() *object.Enviroment {
+		env := object.NewEnviroment()
+		env.SetCheckedArithmetic(true)
+		return env
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "integer overflow: 9223372036854775807 + 1"},
+		{"3037000500 * 3037000500", "integer overflow: 3037000500 * 3037000500"},
+		{"2 ** 64", "integer overflow: 2 ** 64"},
+		{"-(-9223372036854775807 - 1)", "integer overflow: --9223372036854775808"},
+		{"let f = fn(x) { x * x }; f(3037000500)", "integer overflow: 3037000500 * 3037000500"},
+	}
+	for _, tt := range tests {
+		evaluated := testEvalEnv(t, tt.input, checked())
+		testErrorObject(t, evaluated, tt.expected)
+	}
+
+	testIntegerObject(t, testEvalEnv(t, "2 ** 62", checked()), 4611686018427387904)
+
+	// the option belongs to the environment, other runs still promote to BigInteger
+	evaluated := testEval(t, "9223372036854775807 + 1")
+	if _, ok := evaluated.(*object.BigInteger); !ok {
+		t.Errorf("expected a BigInteger without checked arithmetic. got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestNumberConversions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"int(3.9)", 3},
+		{"int(-3.9)", -3},
+		{`int("42")`, 42},
+		{"int(7)", 7},
+		{`int("4.2")`, `could not parse "4.2" as INTEGER`},
+		{`float("abc")`, `could not parse "abc" as FLOAT`},
+		{"int(true)", "argument to `int` not supported, got BOOLEAN"},
+		{"1.5 == 1.5", true},
+		{"1 == 1.0", true},
+		{"2.5 > 2", true},
+		{"1 < 0.5", false},
+		{"1.5 + true", "type mismatch: FLOAT + BOOLEAN"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+// fails the test when input does not parse, so every case really runs the evaluator
+func testEval(t *testing.T, input string) object.Object {
+	t.Helper()
+	return testEvalEnv(t, input, object.NewEnviroment())
+}
+
+// like testEval, for tests that set options on env first
+func testEvalEnv(t *testing.T, input string, env *object.Enviroment) object.Object {
+	t.Helper()
+
 	l := lexer.New(input)
 	p := parser.NewParser(l)
 	program := p.ParseProgram()
-	env := object.NewEnviroment()
+	if errors := p.Errors(); len(errors) != 0 {
+		t.Fatalf("parser errors for %q: %q", input, errors)
+	}
 	return Eval(program, env)
 }
 
+func testErrorObject(t *testing.T, obj object.Object, expected string) bool {
+	result, ok := obj.(*object.Error)
+	if !ok {
+		t.Errorf("object is not Error. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, result.Value)
+		return false
+	}
+	return true
+}
+
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	result, ok := obj.(*object.Integer)
 	if !ok {
@@ -56,6 +273,19 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if math.Abs(result.Value-expected) > 1e-9 {
+		t.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+		return false
+	}
+	return true
+}
+
 func TestBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -66,7 +296,7 @@ func TestBooleanExpression(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testBooleanObject(t, evaluated, tt.expected)
 	}
 }
@@ -87,6 +317,38 @@ func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	return true
 }
 
+func TestComparisonOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"2 >= 2", true},
+		{"1 >= 2", false},
+		{"1.5 <= 1.5", true},
+		{"2 >= 1.5", true},
+		{"9007199254740993 > 9007199254740992.0", true},
+		{"100000000000000000000 >= 100000000000000000000", true},
+		{`"apple" < "banana"`, true},
+		{`"apple" > "banana"`, false},
+		{`"abc" <= "abc"`, true},
+		{`"abd" >= "abc"`, true},
+		{`"Z" < "a"`, true},
+		{`"abc" == "abc"`, true},
+		{`"abc" != "abd"`, true},
+		{`float("NaN") == float("NaN")`, false},
+		{`float("NaN") != float("NaN")`, true},
+		{`float("NaN") <= 1`, false},
+	}
+
+	for tt := range slices.Values(tests) {
+		evaluated := testEval(t, tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
 func TestBangOperator(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -101,7 +363,7 @@ func TestBangOperator(t *testing.T) {
 	}
 
 	for tt := range slices.Values(tests) {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testBooleanObject(t, evaluated, tt.expected)
 	}
 }
@@ -121,7 +383,58 @@ func TestIfElseExpressions(t *testing.T) {
 	}
 
 	for tt := range slices.Values(tests) {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && \"a\"", true},
+		{"1 > 2 || 3 < 4", true},
+		{"false && undefinedName", false},
+		{"true || undefinedName", true},
+		{"false && 1 / 0", false},
+		{"let calls = fn() { missing }; true || calls()", true},
+		{"if (1 < 2 && 2 < 3) { true } else { false }", true},
+	}
+
+	for tt := range slices.Values(tests) {
+		evaluated := testEval(t, tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+
+	// the right side is evaluated when the left side does not decide the result
+	testErrorObject(t, testEval(t, "true && undefinedName"), "identifier not found: undefinedName")
+}
+
+func TestWhileStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (i < 5) { i = i + 1; } i", 5},
+		{"let i = 0; while (false) { i = i + 1; } i", 0},
+		{"while (false) { 1 }", nil},
+		{"let i = 0; while (true) { i = i + 1; if (i == 3) { break; } } i", 3},
+		{"let i = 0; let s = 0; while (i < 5) { i = i + 1; if (i % 2 == 0) { continue; } s = s + i; } s", 9},
+		{"let f = fn() { let i = 0; while (true) { i = i + 1; if (i > 4) { return i * 10; } } }; f()", 50},
+	}
+
+	for tt := range slices.Values(tests) {
+		evaluated := testEval(t, tt.input)
 		integer, ok := tt.expected.(int)
 		if ok {
 			testIntegerObject(t, evaluated, int64(integer))
@@ -129,8 +442,698 @@ func TestIfElseExpressions(t *testing.T) {
 			testNullObject(t, evaluated)
 		}
 	}
+
+	// an error stops the loop
+	testErrorObject(t, testEval(t, "let i = 0; while (i < 3) { i = i + 1; missing }"), "identifier not found: missing")
+}
+
+func TestBlockScoping(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { let x = 1 }; x", errorResult("identifier not found: x")},
+		{"if (false) { 1 } else { let y = 2 }; y", errorResult("identifier not found: y")},
+		{"let i = 0; while (i < 1) { let x = i; i += 1 }; x", errorResult("identifier not found: x")},
+		{"let x = 1; if (true) { x = 2 }; x", 2},
+		{"let x = 1; if (true) { let x = 2; x += 1 }; x", 1},
+		{"let x = 1; if (true) { let x = 2; x }", 2},
+		{"let fs = []; let i = 0; while (i < 3) { let j = i; fs = push(fs, fn() { j }); i += 1 }; fs[0]() + fs[2]()", 2},
+		{"if (true) { fn f() { 1 } }; f()", errorResult("identifier not found: f")},
+		{"const c = 1; if (true) { let c = 2; c }", 2},
+	}
+
+	for tt := range slices.Values(tests) {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorResult:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestLegacyBlockScope(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"if (true) { let x = 1 }; x", 1},
+		{"let i = 0; while (i < 5) { let i = i + 1 }; i", 5},
+		{"let f = fn() { if (true) { let y = 2 }; y }; f()", 2},
+	}
+
+	for tt := range slices.Values(tests) {
+		env := object.NewEnviroment()
+		env.SetLegacyBlockScope(true)
+		testIntegerObject(t, testEvalEnv(t, tt.input, env), tt.expected)
+	}
+
+	// the option belongs to the environment, other runs keep block scoping
+	testErrorObject(t, testEval(t, "if (true) { let x = 1 }; x"), "identifier not found: x")
+}
+
+func TestTryStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"try { 1 } catch (e) { 2 }", 1},
+		{"try { 1 / 0 } catch (e) { 2 }", 2},
+		{`try { throw "bad" } catch (e) { e["message"] }`, "bad"},
+		{`try { throw "bad" } catch (e) { e["kind"] }`, "Error"},
+		{`try { throw 42 } catch (e) { e["value"] }`, 42},
+		{`try { throw 42 } catch (e) { e["message"] }`, "42"},
+		{`try { missing } catch (e) { e["message"] }`, "identifier not found: missing"},
+		{`try { missing } catch (e) { e["kind"] }`, "RuntimeError"},
+		{`try { 1 + true } catch (e) { e["value"] }`, nil},
+		{`try { throw {"kind": "ValueError", "message": "no"} } catch (e) { e["kind"] + ": " + e["message"] }`, "ValueError: no"},
+		{`let f = fn(x) { if (x < 0) { throw "negative" }; x }; try { f(-1) } catch (e) { e["message"] }`, "negative"},
+		{`try { throw "a" } catch (e) { throw e }`, errorResult("a")},
+		{`try { throw "a" } catch { 1 }`, 1},
+		{"let x = 0; try { x = 1 } finally { x = x + 10 }; x", 11},
+		{"let x = 0; try { 1 / 0 } catch (e) { x = 1 } finally { x = x + 10 }; x", 11},
+		{"let x = 0; try { try { 1 / 0 } finally { x = 5 } } catch (e) { x = x * 2 }; x", 10},
+		{"try { 1 / 0 } finally { 2 }", errorResult("division by zero: 1 / 0")},
+		{`try { 1 } finally { throw "late" }`, errorResult("late")},
+		{"let f = fn() { try { return 1 } finally { 2 } }; f()", 1},
+		{"let f = fn() { try { return 1 } finally { return 2 } }; f()", 2},
+		{"let i = 0; while (true) { try { i += 1; if (i > 20) { break } } finally { i += 10 } }; i", 33},
+		{"let i = 0; let s = 0; while (i < 5) { try { i += 1; if (i % 2 == 0) { continue }; s += i } finally { s += 100 }; }; s", 509},
+		{"try { let x = 1 } catch (e) { 1 }; x", errorResult("identifier not found: x")},
+		{`try { throw "a" } catch (e) { 1 }; e`, errorResult("identifier not found: e")},
+		{"throw 1 + missing", errorResult("identifier not found: missing")},
+		{`{"a": missing}`, errorResult("identifier not found: missing")},
+	}
+
+	for tt := range slices.Values(tests) {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+			}
+		case errorResult:
+			testErrorObject(t, evaluated, string(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestCaughtErrorPosition(t *testing.T) {
+	input := `let pos = 0;
+try {
+  let x = 1;
+  x / 0
+} catch (e) { pos = e["line"] * 100 + e["column"] };
+pos`
+
+	testIntegerObject(t, testEval(t, input), 403)
+
+	evaluated := testEval(t, `let x = 1; throw {"kind": "ValueError", "message": "bad"}`)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Value != "bad" || errObj.Kind != "ValueError" {
+		t.Errorf("wrong error. got=%q (%s)", errObj.Value, errObj.Kind)
+	}
+	if errObj.Pos.Line != 1 || errObj.Pos.Column != 12 {
+		t.Errorf("wrong position. got=%s", errObj.Pos)
+	}
+	if _, ok := errObj.Thrown.(*object.Hash); !ok {
+		t.Errorf("thrown value is not Hash. got=%T", errObj.Thrown)
+	}
+}
+
+func TestForStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn(arr) { for (x in arr) { if (x > 2) { return x } } }; f([1, 2, 3, 4])", 3},
+		{"let f = fn(arr) { for (i, x in arr) { if (x == 30) { return i } } }; f([10, 20, 30])", 2},
+		{`let f = fn(s) { for (i, c in s) { if (c == "l") { return i } } }; f("hello")`, 2},
+		{`let f = fn(s) { for (c in s) { if (c != "é") { return 0 } return len(c) } }; f("é")`, 2},
+		{`let f = fn(h) { for (k, v in h) { return v } }; f({"b": 2, "a": 1, "c": 3})`, 1},
+		{`let f = fn(h) { for (k in h) { if (k == "c") { return 3 } } }; f({"b": 2, "a": 1, "c": 3})`, 3},
+		{"let f = fn() { for (i in range(0, 1000000000000)) { if (i == 5) { return i } } }; f()", 5},
+		{"let f = fn() { for (i in range(10, 0, -3)) { if (i < 5) { return i } } }; f()", 4},
+		{"let f = fn() { for (i in range(3)) { if (i < 1) { continue } return i } }; f()", 1},
+		{"for (x in [1, 2, 3]) { x }", nil},
+		{"for (x in []) { missing }", nil},
+		{"for (x in range(5, 0)) { missing }", nil},
+		{"for (x in [1, 2, 3]) { if (x == 2) { break } }", nil},
+		{"len(range(0, 10, 3))", 4},
+		{"len(range(10, 0, -3))", 4},
+		{"len(range(0))", 0},
+		{"let f = fn() { for (x in [1, 2]) { let y = x } y }; f()", "identifier not found: y"},
+		{"for (x in 5) { x }", "cannot iterate over INTEGER"},
+		{"range(0, 10, 0)", "`range` step must not be 0"},
+		{`range("a")`, "argument 0 to `range` must be INTEGER, got STRING"},
+		{"range(0, 100000000000000000000)", "argument 1 to `range` is out of range: 100000000000000000000"},
+		{"range(-100000000000000000000)", "argument 0 to `range` is out of range: -100000000000000000000"},
+	}
+
+	for tt := range slices.Values(tests) {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; x = 2", 2},
+		{"let x = 10; x += 5; x", 15},
+		{"let x = 10; x -= 5; x", 5},
+		{"let x = 10; x *= 5; x", 50},
+		{"let x = 10; x /= 5; x", 2},
+		{`let s = "a"; s += "b"; s`, "ab"},
+		{"let a = 1; let b = 2; a = b = 3; a + b", 6},
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()", 3},
+		{"let x = 1; let f = fn() { x = 2 }; f(); x", 2},
+		{"let x = 1; let f = fn() { let x = 5; x = 2 }; f(); x", 1},
+		{"let i = 0; let total = 0; while (i < 5) { i += 1; total += i } total", 15},
+		{"let x = 1; let x = 2; x", 2},
+		{"y = 1", errorResult("assignment to undeclared variable: y")},
+		{"y += 1", errorResult("assignment to undeclared variable: y")},
+		{"let f = fn() { let z = 1 }; f(); z = 2", errorResult("assignment to undeclared variable: z")},
+		{"let x = 1; x /= 0", errorResult("division by zero: 1 / 0")},
+		{`let x = 1; x += "a"`, errorResult("type mismatch: INTEGER + STRING")},
+	}
+
+	for tt := range slices.Values(tests) {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+			}
+		case errorResult:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestIndexAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = [1, 2, 3]; a[0] = 10; a[0] + a[1]", 12},
+		{"let a = [1, 2, 3]; a[2] = 5", 5},
+		{"let a = [1, 2, 3]; a[1] *= 10; a[1]", 20},
+		{"let a = [1, 2]; let b = a; b[0] = 7; a[0]", 7},
+		{"let m = [[1, 2], [3, 4]]; m[1][0] = 9; m[1][0]", 9},
+		{"let set = fn(arr) { arr[0] = 42 }; let a = [0]; set(a); a[0]", 42},
+		{`let h = {}; h["a"] = 1; h["b"] = 2; h["a"] + h["b"]`, 3},
+		{`let h = {"a": 1}; h["a"] += 5; h["a"]`, 6},
+		{"let h = {}; h[true] = 1; h[1] = 2; h[true] + h[1]", 3},
+		{`let h = {}; h["x"] = 1; len(h)`, 1},
+		{`let h = {"n": 0}; let i = 0; while (i < 3) { h["n"] += i; i += 1 } h["n"]`, 3},
+		{"let a = [1, 2, 3]; a[3] = 1", errorResult("index out of range: 3 with length 3")},
+		{"let a = [1, 2, 3]; a[-1] = 1", errorResult("index out of range: -1 with length 3")},
+		{"let a = [1]; a[100000000000000000000] = 1", errorResult("index out of range: 100000000000000000000 with length 1")},
+		{`let a = [1]; a["0"] = 1`, errorResult("array index must be INTEGER, got STRING")},
+		{"let h = {}; h[[1]] = 1", errorResult("unusable as hash key: ARRAY")},
+		{`let h = {}; h["a"] += 1`, errorResult("key not found: a")},
+		{`let s = "abc"; s[0] = "x"`, errorResult("index assignment not supported: STRING")},
+		{"let a = [1]; a[0] = missing", errorResult("identifier not found: missing")},
+		{"missing[0] = 1", errorResult("identifier not found: missing")},
+	}
+
+	for tt := range slices.Values(tests) {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorResult:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestCyclicInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = [1, 2]; a[0] = a; a", "[[...], 2]"},
+		{`let h = {"n": 1}; h["self"] = h; h`, "{n: 1, self: {...}}"},
+		{`let a = [1]; let h = {"a": a}; a[0] = h; a`, "[{a: [...]}]"},
+		{"let a = [1]; let b = [a, a]; b", "[[1], [1]]"},
+	}
+
+	for tt := range slices.Values(tests) {
+		evaluated := testEval(t, tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong inspect for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestConstBindings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"const x = 5; x", 5},
+		{"const x = 5; let f = fn() { let x = 1; x = 2; x }; f()", 2},
+		{"const x = 5; let f = fn(x) { x += 1 }; f(1)", 2},
+		{"const x = 5; let f = fn() { const x = 10; x }; f() + x", 15},
+		{"const a = [1, 2]; a[0] = 5; a[0]", 5},
+		{"let x = 1; const x = 2; x", 2},
+		{"const x = 5; x = 6", errorResult("cannot assign to constant: x")},
+		{"const x = 5; x += 1", errorResult("cannot assign to constant: x")},
+		{"const x = 5; let f = fn() { x = 6 }; f()", errorResult("cannot assign to constant: x")},
+		{"const x = 5; let x = 6", errorResult("cannot redeclare constant: x")},
+		{"const x = 5; const x = 6", errorResult("cannot redeclare constant: x")},
+		{"const x = 5; let x = 6; x", errorResult("cannot redeclare constant: x")},
+	}
+
+	for tt := range slices.Values(tests) {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorResult:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestIfExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = if (true) { 1 } else { 2 }; x", 1},
+		{"let x = if (false) { 1 } else { 2 }; x", 2},
+		{"let x = if (false) { 1 }; x", nil},
+		{"let sign = fn(n) { if (n < 0) { -1 } else if (n == 0) { 0 } else { 1 } }; sign(-5) + sign(0) * 10 + sign(7) * 100", 99},
+		{"let grade = fn(n) { if (n > 90) { 4 } else if (n > 80) { 3 } else if (n > 70) { 2 } else { 1 } }; grade(85)", 3},
+		{"let grade = fn(n) { if (n > 90) { 4 } else if (n > 80) { 3 } }; grade(10)", nil},
+		{"1 + if (true) { 2 } else { 3 } * 10", 21},
+		{"len([if (true) { 1 }, if (false) { 2 } else { 3 }])", 2},
+		{"let f = fn(n) { let x = if (n > 0) { return 10 } else { 5 }; x * 2 }; f(1) + f(0)", 20},
+		{"if (missing) { 1 } else { 2 }", errorResult("identifier not found: missing")},
+		{"let f = fn() { while (true) { let x = [1, if (true) { break }] } 5 }; f()", 5},
+		{"let f = fn() { let i = 0; while (i < 3) { i += 1; let h = {i: if (i < 3) { continue } else { i }}; return h[i] } }; f()", 3},
+		{"let g = fn(x) { x }; let f = fn(c) { g(if (c) { return 7 }); 99 }; f(true) + f(false)", 106},
+		{"let f = fn() { 1 + if (true) { return 7 } else { 0 } }; f()", 7},
+		{"let f = fn() { -if (true) { return 7 } }; f()", 7},
+		{"let f = fn(a) { a[if (true) { return 7 }] }; f([1])", 7},
+		{"let y = if (true) { }; y", nil},
+		{"let y = if (false) { 1 } else { let z = 2 }; y", nil},
+		{"len([if (true) {}])", 1},
+		{"let y = if (true) { }; y + 1", errorResult("type mismatch: NULL + INTEGER")},
+	}
+
+	for tt := range slices.Values(tests) {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorResult:
+			testErrorObject(t, evaluated, string(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
 }
 
+func TestConditionalAndNullishExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"true ? 1 : 2", 1},
+		{"false ? 1 : 2", 2},
+		{"1 > 2 ? 1 : 2 > 1 ? 3 : 4", 3},
+		{"let max = fn(a, b) { a > b ? a : b }; max(3, 7)", 7},
+		{"true ? 1 : missing", 1},
+		{"false ? missing : 2", 2},
+		{`let h = {"a": 1}; h["b"] ?? 5`, 5},
+		{`let h = {"a": 1}; h["a"] ?? 5`, 1},
+		{"[1, 2][5] ?? [1, 2][0]", 1},
+		{"0 ?? 5", 0},
+		{"false ?? 5", false},
+		{"1 ?? missing", 1},
+		{`let h = {}; h["a"] ?? h["b"] ?? 3`, 3},
+		{`let h = {}; h["a"] ?? h["b"]`, nil},
+		{"missing ? 1 : 2", errorResult("identifier not found: missing")},
+		{"[][0] ?? missing", errorResult("identifier not found: missing")},
+	}
+
+	for tt := range slices.Values(tests) {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorResult:
+			testErrorObject(t, evaluated, string(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestNullAndOptionalAccess(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"null", nil},
+		{"let x = null; x", nil},
+		{"null == null", true},
+		{"null != null", false},
+		{"null == 0", false},
+		{"false == null", false},
+		{`"" != null`, true},
+		{`let h = {"a": 1}; h["b"] == null`, true},
+		{"!null", true},
+		{`let cfg = {"server": {"port": 8080}}; cfg?.server?.port`, 8080},
+		{`let cfg = {"server": {"port": 8080}}; cfg?["server"]?["port"]`, 8080},
+		{`let cfg = {}; cfg?.server?.port`, nil},
+		{`let cfg = null; cfg?.server`, nil},
+		{`let cfg = null; cfg?[missing]`, nil},
+		{`let cfg = {}; cfg?.server?.port ?? 80`, 80},
+		{"let a = null; a?[0]", nil},
+		{"let a = [1, 2]; a?[1]", 2},
+		{`let cfg = {}; cfg?.server["port"]`, nil},
+		{`let h = null; h?["a"]["b"]`, nil},
+		{`let h = null; h?.a["b"]?.c[0]`, nil},
+		{`let h = {"a": null}; h["a"]?["b"]["c"]`, nil},
+		{`let h = {"a": {"b": [1, 2]}}; h?.a["b"][1]`, 2},
+		{`let h = {"a": {"b": [1, 2]}}; h["a"]?.b[5]["c"]`, errorResult("index operator not supported: NULL")},
+		{`let h = {}; h["a"]["b"]`, errorResult("index operator not supported: NULL")},
+		{`let h = null; h?["a"][missing]`, nil},
+		{"null[0]", errorResult("index operator not supported: NULL")},
+		{"null < 1", errorResult("type mismatch: NULL < INTEGER")},
+		{"5?.x", errorResult("index operator not supported: INTEGER")},
+	}
+
+	for tt := range slices.Values(tests) {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorResult:
+			testErrorObject(t, evaluated, string(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`match (1) { 0 => "zero", 1 => "one", _ => "many" }`, "one"},
+		{`match (5) { 0 => "zero", 1 => "one", _ => "many" }`, "many"},
+		{`match (-2) { -2 => "minus two", _ => "other" }`, "minus two"},
+		{`match (2.0) { 2 => "two", _ => "other" }`, "two"},
+		{`match ("2") { 2 => "number", "2" => "string" }`, "string"},
+		{`match (null) { 0 => "zero", null => "null" }`, "null"},
+		{`match (false) { null => "null", false => "false" }`, "false"},
+		{"match (7) { n => n * 2 }", 14},
+		{"match (7) { n if n > 10 => 1, n if n > 5 => 2, _ => 3 }", 2},
+		{"match ([1, 2, 3]) { [] => 0, [a] => a, [a, b] => a + b, [a, ...rest] => len(rest) }", 2},
+		{"match ([]) { [] => 0, [a, ...rest] => a }", 0},
+		{"match ([1]) { [a, ...rest] => len(rest) }", 0},
+		{"match ([1, 2]) { [a, b, c] => 3, [a, b] => 2 }", 2},
+		{"match ([1, [2, 3]]) { [a, [b, c]] => a + b + c }", 6},
+		{"match ([1, 2]) { [1, x] => x, _ => 0 }", 2},
+		{"match ([3, 2]) { [1, x] => x, _ => 0 }", 0},
+		{`match ({"type": "circle", "r": 2}) { {"type": "square", "side": s} => s * s, {"type": "circle", "r": r} => 3 * r * r }`, 12},
+		{`match ({"a": 1}) { {"b": b} => b, {"a": a} => a }`, 1},
+		{`match ({"a": {"b": 5}}) { {"a": {"b": b}} => b }`, 5},
+		{`match ("x") { {"a": a} => a, [a] => a, _ => 9 }`, 9},
+		{"let x = 1; match (5) { x if x > 10 => 0, _ => x }", 1},
+		{"match (1) { 1 => { let y = 5; y * 2 } }", 10},
+		{"match (1) { 1 => {} }", nil},
+		{"let f = fn(x) { match (x) { 1 => { return 10 } _ => 0 }; 20 }; f(1) + f(2)", 30},
+		{`let sum = fn(arr) { match (arr) { [] => 0, [head, ...tail] => head + sum(tail) } }; sum([1, 2, 3, 4])`, 10},
+		{"let a = [1, 2, 3]; match (a) { [x, ...rest] => { rest[0] = 9; a[1] } }", 2},
+		{"match (3) { 1 => 1, 2 => 2 }", errorResult("no match for 3")},
+		{"match (missing) { _ => 1 }", errorResult("identifier not found: missing")},
+		{"match (1) { n if missing => 1 }", errorResult("identifier not found: missing")},
+		{"match (1) { n => n + missing }", errorResult("identifier not found: missing")},
+		{"...a", errorResult("unexpected spread: ...a")},
+	}
+
+	for tt := range slices.Values(tests) {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+			}
+		case errorResult:
+			testErrorObject(t, evaluated, string(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let [a, b] = [1, 2]; a * 10 + b", 12},
+		{"let [a, b, ...rest] = [1, 2, 3, 4]; len(rest) * 100 + rest[0] * 10 + rest[1]", 234},
+		{"let [a, ...rest] = [1]; len(rest)", 0},
+		{"let [_, b] = [1, 2]; b", 2},
+		{"let [a, [b, c]] = [1, [2, 3]]; a + b + c", 6},
+		{`let {"name": n, "age": a} = {"name": "ann", "age": 30}; a`, 30},
+		{`let {"user": {"id": id}} = {"user": {"id": 7}}; id`, 7},
+		{`let {"xs": [x, ...rest]} = {"xs": [4, 5]}; x + rest[0]`, 9},
+		{"let [1, b] = [1, 2]; b", 2},
+		{"let swap = fn([a, b]) { [b, a] }; swap([1, 2])[0]", 2},
+		{`let name = fn({"name": n}) { n }; len(name({"name": "bob", "x": 1}))`, 3},
+		{"let f = fn([a, ...rest], k) { len(rest) + k }; f([1, 2, 3], 10)", 12},
+		{"let f = fn() { let [a, b] = [1, 2]; a + b }; f()", 3},
+		{"const [a, b] = [1, 2]; a = 5", errorResult("cannot assign to constant: a")},
+		{"const a = 1; let [a, b] = [1, 2]", errorResult("cannot redeclare constant: a")},
+		{"let [a, b] = [1, 2, 3]", errorResult("expected 2 elements, got 3")},
+		{"let [a, b] = [1]", errorResult("expected 2 elements, got 1")},
+		{"let [a, b, ...rest] = [1]", errorResult("expected at least 2 elements, got 1")},
+		{"let [a] = 5", errorResult("cannot destructure INTEGER as ARRAY")},
+		{`let {"a": a} = [1]`, errorResult("cannot destructure ARRAY as HASH")},
+		{`let {"name": n} = {"id": 1}`, errorResult("key not found: name")},
+		{"let [1, b] = [2, 3]", errorResult("pattern 1 does not match 2")},
+		{"let f = fn([a, b]) { a }; f([1])", errorResult("argument 0: expected 2 elements, got 1")},
+		{`let f = fn(x, {"k": v}) { v }; f(1, {})`, errorResult("argument 1: key not found: k")},
+		{"let [a] = missing", errorResult("identifier not found: missing")},
+	}
+
+	for tt := range slices.Values(tests) {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorResult:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestFunctionArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn(x, y = 10) { x + y }; f(1)", 11},
+		{"let f = fn(x, y = 10) { x + y }; f(1, 2)", 3},
+		{"let f = fn(x, y = x * 2) { y }; f(4)", 8},
+		{"let n = 0; let f = fn(x = n) { x }; n = 5; f()", 5},
+		{"let f = fn(first, ...rest) { len(rest) }; f(1)", 0},
+		{"let f = fn(first, ...rest) { rest[1] }; f(1, 2, 3)", 3},
+		{"let f = fn(...all) { len(all) }; f()", 0},
+		{"let add = fn(a, b, c) { a + b + c }; let xs = [1, 2, 3]; add(...xs)", 6},
+		{"let add = fn(a, b, c) { a + b + c }; add(1, ...[2], ...[3])", 6},
+		{"len([0, ...[1, 2], 3])", 4},
+		{"let f = fn(...xs) { len(xs) }; f(...[], ...[1, 2])", 2},
+		{"let f = fn(x, y = 1, z = 2) { x * 100 + y * 10 + z }; f(1, z: 5)", 115},
+		{"let f = fn(x, y) { x - y }; f(y: 1, x: 10)", 9},
+		{"let f = fn(x, y) { x - y }; f(10, y: 1)", 9},
+		{"let s = 0; let g = fn(x) { s = s * 10 + x }; let f = fn(x, y, z) { 0 }; f(g(1), g(2), z: g(3)); s", 123},
+		{"let s = 0; let g = fn(x) { s = s * 10 + x }; let f = fn(x, y, z) { 0 }; f(z: g(1), x: g(2), y: g(3)); s", 123},
+		{"let f = fn(x, y = 10) { y }; f(y: 1, x: 2)", 1},
+		{"let f = fn(x) { x }; f(1, 2)", errorResult("wrong number of arguments. got=2, want=1")},
+		{"let f = fn(x, y) { x }; f(1)", errorResult("wrong number of arguments. got=1, want=2")},
+		{"let f = fn(x, y = 1) { x }; f()", errorResult("wrong number of arguments. got=0, want=1 to 2")},
+		{"let f = fn(x, y = 1) { x }; f(1, 2, 3)", errorResult("wrong number of arguments. got=3, want=1 to 2")},
+		{"let f = fn(x, ...rest) { x }; f()", errorResult("wrong number of arguments. got=0, want at least 1")},
+		{"let f = fn(x, y) { x }; f(y: 1)", errorResult("missing argument for parameter x")},
+		{"let f = fn(x) { x }; f(1, x: 2)", errorResult("multiple values for argument: x")},
+		{"let f = fn(x) { x }; f(x: 1, x: 2)", errorResult("keyword argument repeated: x")},
+		{"let f = fn(x) { x }; f(1, z: 2)", errorResult("unexpected keyword argument: z")},
+		{"let f = fn(x, ...rest) { x }; f(1, rest: 2)", errorResult("unexpected keyword argument: rest")},
+		{"let f = fn(x) { x }; f(...5)", errorResult("cannot spread INTEGER")},
+		{"len(x: [1])", errorResult("builtin functions do not take keyword arguments")},
+		{"let f = fn(x = missing) { x }; f()", errorResult("identifier not found: missing")},
+		{"let f = fn(x) { x }; f(y: missing)", errorResult("identifier not found: missing")},
+	}
+
+	for tt := range slices.Values(tests) {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorResult:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestFunctionDeclarations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"fn double(x) { x * 2 } double(4)", 8},
+		{"let r = double(4); fn double(x) { x * 2 } r", 8},
+		{`
+let r = isEven(10) + isOdd(7) * 10;
+fn isEven(n) { if (n == 0) { 1 } else { isOdd(n - 1) } }
+fn isOdd(n) { if (n == 0) { 0 } else { isEven(n - 1) } }
+r
+`, 11},
+		{"let f = fn() { let r = g(); fn g() { 3 } r }; f()", 3},
+		{"let f = fn() { fn g() { 3 } }; f(); g()", errorResult("identifier not found: g")},
+		{"fn counter() { let n = 0; fn next() { n += 1 } next }; let c = counter(); c(); c()", 2},
+		{"fn f() { 1 } fn f() { 2 } f()", 2},
+		{"fn f(x, y = 2) { x + y } f(1)", 3},
+		{"const f = 1; fn f() { 2 }", errorResult("cannot redeclare constant: f")},
+		{"fn f() { 2 } const f = 1;", errorResult("cannot redeclare constant: f")},
+		{"let f = fn() { const g = 1; fn g() { 2 } }; f()", errorResult("cannot redeclare constant: g")},
+		{"fn f() { 1 }", nil},
+	}
+
+	for tt := range slices.Values(tests) {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorResult:
+			testErrorObject(t, evaluated, string(expected))
+		default:
+			if evaluated != nil {
+				t.Errorf("declaration produced a value. got=%T (%+v)", evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestFunctionNames(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn add(x, y) { x + y } add", "fn add(x, y) {\n(x + y)\n}"},
+		{"let sub = fn(x) { x }; sub", "fn sub(x) {\nx\n}"},
+		{"fn(x) { x }", "fn(x) {\nx\n}"},
+		{"let f = fn() { 1 }; let g = f; g", "fn f() {\n1\n}"},
+	}
+
+	for tt := range slices.Values(tests) {
+		evaluated := testEval(t, tt.input)
+		fn, ok := evaluated.(*object.Function)
+		if !ok {
+			t.Errorf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if fn.Inspect() != tt.expected {
+			t.Errorf("wrong inspect. expected=%q, got=%q", tt.expected, fn.Inspect())
+		}
+	}
+}
+
+func TestArrowFunctionsAndPipes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let triple = x => x * 3; triple(4)", 12},
+		{"let add = (a, b) => a + b; add(2, 3)", 5},
+		{"let one = () => 1; one()", 1},
+		{"let adder = a => b => a + b; adder(2)(5)", 7},
+		{"let f = x => { let y = x * 2; y + 1 }; f(3)", 7},
+		{"let f = (x, y = 10) => x + y; f(1)", 11},
+		{"let f = (...xs) => len(xs); f(1, 2, 3)", 3},
+		{"let f = ([a, b]) => a * b; f([3, 4])", 12},
+		{"let n = 5; let f = () => n; n = 6; f()", 6},
+		{`
+fn map(arr, f) { match (arr) { [] => [], [x, ...rest] => [f(x), ...map(rest, f)] } }
+fn sum(arr) { match (arr) { [] => 0, [x, ...rest] => x + sum(rest) } }
+[1, 2, 3] |> map(x => x * 2) |> sum
+`, 12},
+		{"let inc = x => x + 1; 1 |> inc |> inc", 3},
+		{"2 |> (x => x * 10)", 20},
+		{"let sub = (a, b) => a - b; 10 |> sub(3)", 7},
+		{"let f = fn(a, b = 0) { a - b }; 10 |> f(b: 4)", 6},
+		{"match (1) { 1 => x => x + 1 }(5)", 6},
+		{"let f = x => x; f(1, 2)", errorResult("wrong number of arguments. got=2, want=1")},
+		{"1 |> 2", errorResult("not a function: INTEGER")},
+	}
+
+	for tt := range slices.Values(tests) {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorResult:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+// expected error message in table tests that also expect plain strings
+type errorResult string
+
 func testNullObject(t *testing.T, obj object.Object) bool {
 	if obj != NULL {
 		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
@@ -183,19 +1186,8 @@ func TestErrorHandling(t *testing.T) {
 	}
 
 	for tt := range slices.Values(tests) {
-		evaluated := testEval(tt.input)
-		errObj, ok := evaluated.(*object.Error)
-
-		if !ok {
-			t.Errorf("no error object returned. got=%T(%+v)",
-				evaluated, evaluated)
-			continue
-		}
-		if errObj.Value != tt.expected {
-			t.Errorf("wrong error message. expected=%q, got=%q",
-				tt.expected, errObj.Value)
-		}
-
+		evaluated := testEval(t, tt.input)
+		testErrorObject(t, evaluated, tt.expected)
 	}
 }
 
@@ -210,7 +1202,7 @@ func TestReturnStatements(t *testing.T) {
 		{"9; return 2 * 5; 9;", 10},
 	}
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testIntegerObject(t, evaluated, tt.expected)
 	}
 }
@@ -227,13 +1219,13 @@ func TestLetStatements(t *testing.T) {
 	}
 
 	for tt := range slices.Values(tests) {
-		testIntegerObject(t, testEval(tt.input), tt.expected)
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
 	}
 }
 
 func TestFunctionObject(t *testing.T) {
 	input := "fn(x) { x + 2; };"
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	fn, ok := evaluated.(*object.Function)
 	if !ok {
 		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
@@ -264,13 +1256,13 @@ func TestFunctionApplication(t *testing.T) {
 		{"fn(x) { x; }(5)", 5},
 	}
 	for _, tt := range tests {
-		testIntegerObject(t, testEval(tt.input), tt.expected)
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
 	}
 }
 
 func TestStringLiteral(t *testing.T) {
 	input := `"Hello World!"`
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	str, ok := evaluated.(*object.String)
 	if !ok {
 		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
@@ -282,7 +1274,7 @@ func TestStringLiteral(t *testing.T) {
 
 func TestStringConcatenation(t *testing.T) {
 	input := `"Hello" + " " + "World!"`
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	str, ok := evaluated.(*object.String)
 	if !ok {
 		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
@@ -308,28 +1300,19 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`count("abca")`, "wrong number of arguments. got=1, want=2"},
 	}
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		switch expected := tt.expected.(type) {
 		case int:
 			testIntegerObject(t, evaluated, int64(expected))
 		case string:
-			errObj, ok := evaluated.(*object.Error)
-			if !ok {
-				t.Errorf("object is not Error. got=%T (%+v)",
-					evaluated, evaluated)
-				continue
-			}
-			if errObj.Value != expected {
-				t.Errorf("wrong error message. expected=%q, got=%q",
-					expected, errObj.Value)
-			}
+			testErrorObject(t, evaluated, expected)
 		}
 	}
 }
 
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	result, ok := evaluated.(*object.Array)
 	if !ok {
 		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
@@ -390,7 +1373,7 @@ func TestArrayIndexExpressions(t *testing.T) {
 		},
 	}
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		integer, ok := tt.expected.(int)
 		if ok {
 			testIntegerObject(t, evaluated, int64(integer))
@@ -410,7 +1393,7 @@ two: 1 + 1,
 true: 5,
 false: 6
 }`
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	result, ok := evaluated.(*object.Hash)
 	if !ok {
 		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
@@ -468,9 +1451,25 @@ func TestHashIndexExpressions(t *testing.T) {
 			`{false: 5}[false]`,
 			5,
 		},
+		{
+			`{1: 5}[1.0]`,
+			5,
+		},
+		{
+			`{0.0: 5}[-0.0]`,
+			5,
+		},
+		{
+			`{1.5: 5}[1]`,
+			nil,
+		},
+		{
+			`let h = {}; h[2] = 1; h[2.0] = 5; len(h) + h[2]`,
+			6,
+		},
 	}
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		integer, ok := tt.expected.(int)
 		if ok {
 			testIntegerObject(t, evaluated, int64(integer))
@@ -479,3 +1478,59 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"foobar", "1:1"},
+		{"let a = 1;\nlet b = a + true;", "2:9"},
+		{"let f = fn(x) {\n  x + y\n};\nf(1)", "2:7"},
+		{"len(1)", "1:1"},
+	}
+
+	for tt := range slices.Values(tests) {
+		evaluated := testEval(t, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Pos.String() != tt.expected {
+			t.Errorf("wrong error position. expected=%s, got=%s", tt.expected, errObj.Pos)
+		}
+	}
+}
+
+func TestErrorTraces(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"missing", []string{}},
+		{"let f = fn(x) { x + y };\nf(1)", []string{"in f, called at 2:1"}},
+		{"fn inner() { missing }\nfn outer() {\n  inner()\n}\nouter()", []string{"in inner, called at 3:3", "in outer, called at 5:1"}},
+		{"let f = fn(n) { if (n == 0) { missing } else { f(n - 1) } };\nf(2)", []string{"in f, called at 1:48", "in f, called at 1:48", "in f, called at 2:1"}},
+		{"fn(x) { x / 0 }(1)", []string{"in anonymous function, called at 1:1"}},
+		{"1 |> fn(x) { x / 0 }", []string{"in anonymous function, called at 1:1"}},
+		{"let f = fn(x) { x }; f(1, 2)", []string{}},
+		{"len(1)", []string{}},
+	}
+
+	for tt := range slices.Values(tests) {
+		evaluated := testEval(t, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		trace := []string{}
+		for _, frame := range errObj.Trace {
+			trace = append(trace, frame.String())
+		}
+		if !slices.Equal(trace, tt.expected) {
+			t.Errorf("wrong trace for %q. expected=%q, got=%q", tt.input, tt.expected, trace)
+		}
+	}
+}
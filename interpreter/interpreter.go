@@ -11,15 +11,17 @@ import (
 	"monkey/parser"
 )
 
-func Interpreter(path string) error {
+// legacyBlockScope runs scripts written before if/else and while bodies had their own scope
+func Interpreter(path string, legacyBlockScope bool) error {
 	env := object.NewEnviroment()
+	env.SetLegacyBlockScope(legacyBlockScope)
 	var out io.Writer
 	f, err := os.ReadFile(path)
 	if err != nil {
 		panic(err)
 	}
 
-	l := lexer.New(string(f))
+	l := lexer.NewFile(path, string(f))
 	p := parser.NewParser(l)
 	prog := p.ParseProgram()
 
@@ -38,7 +40,7 @@ func Interpreter(path string) error {
 }
 
 func printErrors(out io.Writer, errors []string) {
-	fmt.Println("Looks like we ran into some monkey business here...\nparser errors:\n")
+	fmt.Println("Looks like we ran into some monkey business here...\nparser errors:")
 	for _, msg := range errors {
 		fmt.Println(msg)
 	}
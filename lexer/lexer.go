@@ -1,23 +1,49 @@
 package lexer
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
 	"monkey/token"
 )
 
 type Lexer struct {
 	input   string
+	file    string // file name used in token positions, empty for the repl
 	pos     int
 	readPos int
 	ch      byte
+	line    int // line of the current char
+	col     int // column of the current char
+
+	keepComments bool     // return comments as token.COMMENT instead of skipping them
+	errors       []string // diagnostics for ILLEGAL tokens
 }
 
 func New(s string) *Lexer {
-	l := &Lexer{input: s}
+	return NewFile("", s)
+}
+
+// creates a lexer that records filename in the position of every token
+func NewFile(filename, s string) *Lexer {
+	l := &Lexer{input: s, file: filename, line: 1}
 	l.ReadChar()
 	return l
 }
 
 func (l *Lexer) ReadChar() {
+	// already past the end of the input, keep the position at EOF
+	if l.readPos > len(l.input) {
+		return
+	}
+
+	if l.ch == '\n' {
+		l.line += 1
+		l.col = 0
+	}
+
 	if l.readPos >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -26,6 +52,34 @@ func (l *Lexer) ReadChar() {
 
 	l.pos = l.readPos
 	l.readPos += 1
+	l.col += 1
+}
+
+// position of the current char
+func (l *Lexer) position() token.Position {
+	return token.Position{Filename: l.file, Offset: l.pos, Line: l.line, Column: l.col}
+}
+
+// returns the next char without advancing
+func (l *Lexer) peekChar() byte {
+	if l.readPos >= len(l.input) {
+		return 0
+	}
+	return l.input[l.readPos]
+}
+
+// when keep is true comments are returned as token.COMMENT, so a formatter can preserve them
+func (l *Lexer) KeepComments(keep bool) {
+	l.keepComments = keep
+}
+
+func (l *Lexer) Errors() []string {
+	return l.errors
+}
+
+func (l *Lexer) addError(pos token.Position, format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	l.errors = append(l.errors, pos.String()+": "+msg)
 }
 
 func (l *Lexer) skipWhiteSpace() {
@@ -58,43 +112,282 @@ func (l *Lexer) createIdentifier() token.Token {
 	return token.Token{Type: tp, Literal: s}
 }
 
-func (l *Lexer) createInt() token.Token {
-	var s string
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+// reads an integer or a float, floats have a fraction (1.5), an exponent (1e-9) or both
+func (l *Lexer) createNumber() token.Token {
+	pos := l.pos
+	tp := token.TokenType(token.INT)
+
+	l.readDigits()
+
+	// a dot is only part of the number when a digit follows it
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tp = token.FLOAT
+		l.ReadChar()
+		l.readDigits()
+	}
+
+	if l.ch == 'e' || l.ch == 'E' {
+		next := l.peekChar()
+		if isDigit(next) || (next == '+' || next == '-') && l.readPos+1 < len(l.input) && isDigit(l.input[l.readPos+1]) {
+			tp = token.FLOAT
+			l.ReadChar()
+			if l.ch == '+' || l.ch == '-' {
+				l.ReadChar()
+			}
+			l.readDigits()
+		}
+	}
+
+	return token.Token{Type: tp, Literal: l.input[pos:l.pos]}
+}
 
+func (l *Lexer) readDigits() {
 	for l.isDigit() {
-		s += string(l.ch)
 		l.ReadChar()
 	}
+}
+
+// reads from // until the end of the line, the newline is left for skipWhiteSpace
+func (l *Lexer) readLineComment() token.Token {
+	pos := l.pos
+
+	for l.ch != '\n' && l.ch != 0 {
+		l.ReadChar()
+	}
+
+	return token.Token{Type: token.COMMENT, Literal: l.input[pos:l.pos]}
+}
+
+// reads a /* */ comment, comments can be nested so every /* needs a matching */
+func (l *Lexer) readBlockComment() token.Token {
+	start := l.position()
+	pos := l.pos
+	depth := 0
+
+	for {
+		switch {
+		case l.ch == 0:
+			l.addError(start, "unterminated block comment")
+			return token.Token{Type: token.ILLEGAL, Literal: l.input[pos:l.pos]}
+		case l.ch == '/' && l.peekChar() == '*':
+			depth += 1
+			l.ReadChar()
+		case l.ch == '*' && l.peekChar() == '/':
+			depth -= 1
+			l.ReadChar()
+		}
+		l.ReadChar()
 
-	return token.Token{Type: token.INT, Literal: s}
+		if depth == 0 {
+			return token.Token{Type: token.COMMENT, Literal: l.input[pos:l.pos]}
+		}
+	}
 }
 
-func (l *Lexer) readString() string {
-	pos := l.pos + 1
+// reads a "" string decoding escape sequences, the lexer stops on the closing quote
+// a newline or the end of the input before the closing quote makes the token ILLEGAL
+func (l *Lexer) readString() token.Token {
+	start := l.position()
+	pos := l.pos
+	var out strings.Builder
 
 	for {
 		l.ReadChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
+
+		switch l.ch {
+		case '"':
+			return token.Token{Type: token.STRING, Literal: out.String()}
+		case '\n', 0:
+			l.addError(start, "unterminated string literal")
+			return token.Token{Type: token.ILLEGAL, Literal: l.input[pos:l.pos]}
+		case '\\':
+			l.readEscape(&out)
+		default:
+			out.WriteByte(l.ch)
 		}
 	}
+}
+
+// decodes the escape sequence starting at the current \ and writes it to out
+func (l *Lexer) readEscape(out *strings.Builder) {
+	pos := l.position()
+
+	// a \ right before the end of the line is reported as unterminated by readString
+	if next := l.peekChar(); next == '\n' || next == 0 {
+		return
+	}
+	l.ReadChar()
+
+	switch l.ch {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case 'r':
+		out.WriteByte('\r')
+	case '0':
+		out.WriteByte(0)
+	case '\\', '"':
+		out.WriteByte(l.ch)
+	case 'u':
+		l.readUnicodeEscape(pos, out)
+	default:
+		l.addError(pos, "unknown escape sequence \\%c", l.ch)
+		out.WriteByte(l.ch)
+	}
+}
+
+// decodes \u{XXXX} with 1 to 6 hex digits, the current char is the u
+func (l *Lexer) readUnicodeEscape(pos token.Position, out *strings.Builder) {
+	if l.peekChar() != '{' {
+		l.addError(pos, "invalid unicode escape, expected \\u{...}")
+		return
+	}
+	l.ReadChar()
+
+	digits := l.pos + 1
+	for l.peekChar() != '}' && l.peekChar() != '"' && l.peekChar() != '\n' && l.peekChar() != 0 {
+		l.ReadChar()
+	}
+
+	if l.peekChar() != '}' {
+		l.addError(pos, "invalid unicode escape, missing }")
+		return
+	}
+
+	hex := l.input[digits : l.pos+1]
+	l.ReadChar()
+
+	code, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) > 6 || !utf8.ValidRune(rune(code)) {
+		l.addError(pos, "invalid unicode escape \\u{%s}", hex)
+		return
+	}
+
+	out.WriteRune(rune(code))
+}
+
+// reads a string between backticks, raw strings have no escapes and can span multiple lines
+func (l *Lexer) readRawString() token.Token {
+	start := l.position()
+	pos := l.pos
 
-	return l.input[pos:l.pos]
+	for {
+		l.ReadChar()
+
+		switch l.ch {
+		case '`':
+			return token.Token{Type: token.STRING, Literal: l.input[pos+1 : l.pos]}
+		case 0:
+			l.addError(start, "unterminated raw string literal")
+			return token.Token{Type: token.ILLEGAL, Literal: l.input[pos:l.pos]}
+		}
+	}
 }
 
 func (l *Lexer) NextToken() token.Token {
+	for {
+		l.skipWhiteSpace()
+
+		pos := l.position()
+		tk := l.readToken()
+		tk.Pos = pos
+		tk.End = l.position()
+
+		if tk.Type != token.COMMENT || l.keepComments {
+			return tk
+		}
+	}
+}
+
+// reads the token starting at the current char, leaving the lexer after its last char
+func (l *Lexer) readToken() token.Token {
 	var tk token.Token
-	l.skipWhiteSpace()
 
 	switch l.ch {
 	case '+':
-		tk = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '=' {
+			l.ReadChar()
+			tk = token.Token{Type: token.PLUS_ASSIGN, Literal: "+="}
+		} else {
+			tk = newToken(token.PLUS, l.ch)
+		}
 	case '-':
-		tk = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '=' {
+			l.ReadChar()
+			tk = token.Token{Type: token.MINUS_ASSIGN, Literal: "-="}
+		} else {
+			tk = newToken(token.MINUS, l.ch)
+		}
 	case '*':
-		tk = newToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '*' {
+			l.ReadChar()
+			tk = token.Token{Type: token.POWER, Literal: "**"}
+		} else if l.peekChar() == '=' {
+			l.ReadChar()
+			tk = token.Token{Type: token.ASTERISK_ASSIGN, Literal: "*="}
+		} else {
+			tk = newToken(token.ASTERISK, l.ch)
+		}
+	case '%':
+		tk = newToken(token.PERCENT, l.ch)
+	case '&':
+		if l.peekChar() == '&' {
+			l.ReadChar()
+			tk = token.Token{Type: token.AND, Literal: "&&"}
+		} else {
+			l.addError(l.position(), "illegal character %q, did you mean &&?", l.ch)
+			tk = newToken(token.ILLEGAL, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			l.ReadChar()
+			tk = token.Token{Type: token.OR, Literal: "||"}
+		} else if l.peekChar() == '>' {
+			l.ReadChar()
+			tk = token.Token{Type: token.PIPE, Literal: "|>"}
+		} else {
+			l.addError(l.position(), "illegal character %q, did you mean ||?", l.ch)
+			tk = newToken(token.ILLEGAL, l.ch)
+		}
+	case '?':
+		// a?[0] is always optional indexing, a ternary needs a space before an array literal
+		if l.peekChar() == '?' {
+			l.ReadChar()
+			tk = token.Token{Type: token.NULLISH, Literal: "??"}
+		} else if l.peekChar() == '.' {
+			l.ReadChar()
+			tk = token.Token{Type: token.OPTIONAL_DOT, Literal: "?."}
+		} else if l.peekChar() == '[' {
+			l.ReadChar()
+			tk = token.Token{Type: token.OPTIONAL_BRACKET, Literal: "?["}
+		} else {
+			tk = newToken(token.QUESTION, l.ch)
+		}
 	case '/':
-		tk = newToken(token.SLASH, l.ch)
+		if l.peekChar() == '/' {
+			return l.readLineComment()
+		} else if l.peekChar() == '*' {
+			return l.readBlockComment()
+		} else if l.peekChar() == '=' {
+			l.ReadChar()
+			tk = token.Token{Type: token.SLASH_ASSIGN, Literal: "/="}
+		} else {
+			tk = newToken(token.SLASH, l.ch)
+		}
+	case '.':
+		if l.peekChar() == '.' && l.readPos+1 < len(l.input) && l.input[l.readPos+1] == '.' {
+			l.ReadChar()
+			l.ReadChar()
+			tk = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			l.addError(l.position(), "illegal character %q", l.ch)
+			tk = newToken(token.ILLEGAL, l.ch)
+		}
 	case '(':
 		tk = newToken(token.LPAREN, l.ch)
 	case ')':
@@ -114,26 +407,40 @@ func (l *Lexer) NextToken() token.Token {
 	case ',':
 		tk = newToken(token.COMMA, l.ch)
 	case '>':
-		tk = newToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			l.ReadChar()
+			tk = token.Token{Type: token.GT_EQ, Literal: ">="}
+		} else {
+			tk = newToken(token.GT, l.ch)
+		}
 	case '<':
-		tk = newToken(token.LT, l.ch)
+		if l.peekChar() == '=' {
+			l.ReadChar()
+			tk = token.Token{Type: token.LT_EQ, Literal: "<="}
+		} else {
+			tk = newToken(token.LT, l.ch)
+		}
 	case '"':
-		tk.Type = token.STRING
-		tk.Literal = l.readString()
+		tk = l.readString()
+	case '`':
+		tk = l.readRawString()
 	case 0:
 		tk.Literal = ""
 		tk.Type = "EOF"
 	case '!':
-		if l.input[l.readPos] == '=' {
+		if l.peekChar() == '=' {
 			l.ReadChar()
 			tk = token.Token{Type: token.NOT_EQ, Literal: "!" + string(l.ch)}
 		} else {
 			tk = newToken(token.BANG, l.ch)
 		}
 	case '=':
-		if l.input[l.readPos] == '=' {
+		if l.peekChar() == '=' {
 			l.ReadChar()
 			tk = token.Token{Type: token.EQ, Literal: string(l.ch) + string(l.ch)}
+		} else if l.peekChar() == '>' {
+			l.ReadChar()
+			tk = token.Token{Type: token.ARROW, Literal: "=>"}
 		} else {
 			tk = newToken(token.ASSIGN, l.ch)
 		}
@@ -143,9 +450,10 @@ func (l *Lexer) NextToken() token.Token {
 			tk = l.createIdentifier()
 			return tk
 		} else if l.isDigit() {
-			tk = l.createInt()
+			tk = l.createNumber()
 			return tk
 		} else {
+			l.addError(l.position(), "illegal character %q", l.ch)
 			tk = newToken(token.ILLEGAL, l.ch)
 		}
 	}
@@ -91,3 +91,322 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  add(x,
+10)`
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+		expectedEndCol  int
+	}{
+		{"let", 1, 1, 4},
+		{"x", 1, 5, 6},
+		{"=", 1, 7, 8},
+		{"5", 1, 9, 10},
+		{";", 1, 10, 11},
+		{"add", 2, 3, 6},
+		{"(", 2, 6, 7},
+		{"x", 2, 7, 8},
+		{",", 2, 8, 9},
+		{"10", 3, 1, 3},
+		{")", 3, 3, 4},
+		{"", 3, 4, 4},
+	}
+
+	l := NewFile("test.mk", input)
+
+	for i, tt := range tests {
+		tk := l.NextToken()
+
+		if tk.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tk.Literal)
+		}
+
+		if tk.Pos.Line != tt.expectedLine || tk.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%s", i, tt.expectedLine, tt.expectedColumn, tk.Pos)
+		}
+
+		if tk.End.Column != tt.expectedEndCol {
+			t.Fatalf("tests[%d] - end column wrong. expected=%d, got=%d", i, tt.expectedEndCol, tk.End.Column)
+		}
+
+		if tk.Pos.Filename != "test.mk" {
+			t.Fatalf("tests[%d] - filename wrong. got=%q", i, tk.Pos.Filename)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading comment
+let x = 10 / 2; // trailing
+/* block /* nested */ still comment */
+x`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "10"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tk := l.NextToken()
+
+		if tk.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tk.Type)
+		}
+
+		if tk.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tk.Literal)
+		}
+	}
+}
+
+func TestKeepComments(t *testing.T) {
+	input := "x // one\n/* two */"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "x"},
+		{token.COMMENT, "// one"},
+		{token.COMMENT, "/* two */"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	l.KeepComments(true)
+
+	for i, tt := range tests {
+		tk := l.NextToken()
+
+		if tk.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tk.Type)
+		}
+
+		if tk.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tk.Literal)
+		}
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	l := New("1 /* open /* nested */")
+
+	l.NextToken()
+	tk := l.NextToken()
+
+	if tk.Type != token.ILLEGAL {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.ILLEGAL, tk.Type)
+	}
+
+	if len(l.Errors()) != 1 {
+		t.Fatalf("expected 1 lexer error, got=%d", len(l.Errors()))
+	}
+
+	expected := "1:3: unterminated block comment"
+	if l.Errors()[0] != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, l.Errors()[0])
+	}
+
+	if tk := l.NextToken(); tk.Type != token.EOF {
+		t.Errorf("expected EOF after unterminated comment, got=%q", tk.Type)
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+	}{
+		{`"a\nb"`, "a\nb"},
+		{`"tab\there"`, "tab\there"},
+		{`"back\\slash"`, `back\slash`},
+		{`"say \"hi\""`, `say "hi"`},
+		{`"\u{48}\u{e9}\u{1F600}"`, "Hé😀"},
+		{"`raw \\n string`", `raw \n string`},
+		{"`multi\nline`", "multi\nline"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tk := l.NextToken()
+
+		if tk.Type != token.STRING {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, token.STRING, tk.Type)
+		}
+
+		if tk.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tk.Literal)
+		}
+
+		if len(l.Errors()) != 0 {
+			t.Fatalf("tests[%d] - unexpected lexer errors: %v", i, l.Errors())
+		}
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedType  token.TokenType
+		expectedError string
+	}{
+		{`"unterminated`, token.ILLEGAL, "1:1: unterminated string literal"},
+		{"\"broken\nlet", token.ILLEGAL, "1:1: unterminated string literal"},
+		{`"ends with \`, token.ILLEGAL, "1:1: unterminated string literal"},
+		{"`never closed", token.ILLEGAL, "1:1: unterminated raw string literal"},
+		{`"bad \q"`, token.STRING, `1:6: unknown escape sequence \q`},
+		{`"\u{110000}"`, token.STRING, `1:2: invalid unicode escape \u{110000}`},
+		{`"\u{41"`, token.STRING, "1:2: invalid unicode escape, missing }"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tk := l.NextToken()
+
+		if tk.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tk.Type)
+		}
+
+		if len(l.Errors()) != 1 || l.Errors()[0] != tt.expectedError {
+			t.Fatalf("tests[%d] - wrong errors. expected=%q, got=%q", i, tt.expectedError, l.Errors())
+		}
+	}
+
+	// lexing continues on the next line after an unterminated string
+	l := New("\"broken\nlet")
+	l.NextToken()
+	if tk := l.NextToken(); tk.Type != token.LET {
+		t.Errorf("expected LET after unterminated string, got=%q", tk.Type)
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	input := `5 3.14 1e-9 2.5E+3 7e 1.foo 0.5`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "1e-9"},
+		{token.FLOAT, "2.5E+3"},
+		{token.INT, "7"},
+		{token.IDENT, "e"},
+		{token.INT, "1"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "foo"},
+		{token.FLOAT, "0.5"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tk := l.NextToken()
+
+		if tk.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tk.Type)
+		}
+
+		if tk.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tk.Literal)
+		}
+	}
+}
+
+func TestOperators(t *testing.T) {
+	input := `a ** b % c * d && e || f <= g >= h < i > j += k -= l *= m /= n = o ? p : q ?? r s?.t u?[v] null match w => ...x |> y try catch finally throw`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.POWER, "**"},
+		{token.IDENT, "b"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "c"},
+		{token.ASTERISK, "*"},
+		{token.IDENT, "d"},
+		{token.AND, "&&"},
+		{token.IDENT, "e"},
+		{token.OR, "||"},
+		{token.IDENT, "f"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "g"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "h"},
+		{token.LT, "<"},
+		{token.IDENT, "i"},
+		{token.GT, ">"},
+		{token.IDENT, "j"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.IDENT, "k"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.IDENT, "l"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.IDENT, "m"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.IDENT, "n"},
+		{token.ASSIGN, "="},
+		{token.IDENT, "o"},
+		{token.QUESTION, "?"},
+		{token.IDENT, "p"},
+		{token.COLON, ":"},
+		{token.IDENT, "q"},
+		{token.NULLISH, "??"},
+		{token.IDENT, "r"},
+		{token.IDENT, "s"},
+		{token.OPTIONAL_DOT, "?."},
+		{token.IDENT, "t"},
+		{token.IDENT, "u"},
+		{token.OPTIONAL_BRACKET, "?["},
+		{token.IDENT, "v"},
+		{token.RBRACKET, "]"},
+		{token.NULL, "null"},
+		{token.MATCH, "match"},
+		{token.IDENT, "w"},
+		{token.ARROW, "=>"},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "x"},
+		{token.PIPE, "|>"},
+		{token.IDENT, "y"},
+		{token.TRY, "try"},
+		{token.CATCH, "catch"},
+		{token.FINALLY, "finally"},
+		{token.THROW, "throw"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tk := l.NextToken()
+
+		if tk.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tk.Type)
+		}
+
+		if tk.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tk.Literal)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 
@@ -9,17 +10,21 @@ import (
 )
 
 func main() {
-	if len(os.Args) > 1 {
-		if os.Args[1] == "i" {
-			if len(os.Args) < 3 {
+	legacyBlockScope := flag.Bool("legacy-scope", false, "let inside if/else and while bodies stays visible after the block, for older scripts")
+	flag.Parse()
+	args := flag.Args()
+
+	if len(args) > 0 {
+		if args[0] == "i" {
+			if len(args) < 2 {
 				fmt.Print("File not found...")
 				return
-			} else if err := interpreter.Interpreter(os.Args[2]); err != nil {
+			} else if err := interpreter.Interpreter(args[1], *legacyBlockScope); err != nil {
 				panic(err)
 			}
 			return
-		} else if os.Args[1] == "r" {
-			if err := repl.REPL(os.Stdin, os.Stdout); err != nil {
+		} else if args[0] == "r" {
+			if err := repl.REPL(os.Stdin, os.Stdout, *legacyBlockScope); err != nil {
 				panic(err)
 			}
 			return
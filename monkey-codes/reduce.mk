@@ -1,12 +1,8 @@
 let reduce = fn(arr, total, f) {
-	let iterator = fn(arr, res) {
-		if(len(arr) == 0) {
-			res
-		} else {
-			iterator(tail(arr), f(res, first(arr)));	
-		}
-	};
-	iterator(arr, total);
+	match (arr) {
+		[] => total,
+		[head, ...rest] => reduce(rest, f(total, head), f),
+	}
 };
 
 let sum = fn(arr) {
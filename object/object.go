@@ -2,11 +2,18 @@ package object
 
 import (
 	"bytes"
+	"cmp"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"monkey/ast"
+	"monkey/token"
 )
 
 type ObjectType string
@@ -15,15 +22,19 @@ type BuiltinFunction func(args ...Object) Object
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	STRING_OBJ       = "STRING"
 	BUILTIN_OBJ      = "BUILTIN"
 	ERROR_OBJ        = "ERROR"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
 	FUNCTION_OBJ     = "FUNCTION"
 	ARRAY_OBJ        = "ARRAY"
 	NULL_OBJ         = "NULL"
 	HASH_OBJ         = "HASH"
+	RANGE_OBJ        = "RANGE"
 )
 
 type Object interface {
@@ -35,10 +46,37 @@ type Hashable interface {
 	HashKey() HashKey
 }
 
+// objects that can be iterated by for-in loops
+type Iterable interface {
+	Iterator() Iterator
+}
+
+type Iterator interface {
+	// returns the key and value of the next element, ok is false when there are no more elements
+	Next() (key Object, value Object, ok bool)
+}
+
+// objects with a natural ordering, used by comparison operators and sorting
+type Comparable interface {
+	// returns a negative number, zero or a positive number when the receiver is
+	// smaller, equal or greater than other, ok is false if they can not be ordered
+	Compare(other Object) (c int, ok bool)
+}
+
 type Integer struct {
 	Value int64
 }
 
+// integer that does not fit in an int64, its type is still INTEGER for scripts
+// use NewBigInteger so values that fit in an int64 stay on the Integer fast path
+type BigInteger struct {
+	Value *big.Int
+}
+
+type Float struct {
+	Value float64
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -51,8 +89,14 @@ type Return struct {
 	Value Object
 }
 
+// signals that propagate out of a loop body like Return does out of a function
+type Break struct{}
+
+type Continue struct{}
+
 type Function struct {
-	Parameters []*ast.Identifier
+	Name       string // empty for anonymous functions
+	Parameters []ast.Expression
 	Body       *ast.BlockStatement
 	Env        *Enviroment
 }
@@ -79,15 +123,37 @@ type Hash struct {
 	Pairs map[HashKey]HashPair
 }
 
+// sequence of integers from Start up to, but not including, End
+// values are produced lazily so huge ranges do not use memory
+type Range struct {
+	Start int64
+	End   int64
+	Step  int64 // never zero
+}
+
 type Error struct {
-	Value string
+	Value  string
+	Kind   string         // RuntimeError for errors of the interpreter, chosen by the script for thrown ones
+	Thrown Object         // value given to throw, nil for errors of the interpreter
+	Pos    token.Position // position of the node that produced the error
+	Trace  []Frame        // calls the error left on its way out, innermost first
+}
+
+// a function call that was running when an error happened
+type Frame struct {
+	Function string         // name of the function, empty for anonymous ones
+	Pos      token.Position // where it was called
 }
 
 type Null struct{}
 
 type Enviroment struct {
-	store map[string]Object
-	outer *Enviroment
+	store     map[string]Object
+	constants map[string]bool // names in store that were declared with const
+	outer     *Enviroment
+
+	legacyBlockScope  bool // if/else and while bodies share this scope, inherited by enclosed scopes
+	checkedArithmetic bool // integer overflow is an error instead of a BigInteger, inherited by enclosed scopes
 }
 
 func (b *Boolean) HashKey() HashKey {
@@ -106,21 +172,225 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+func (b *BigInteger) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write(b.Value.Bytes())
+	if b.Value.Sign() < 0 {
+		h.Write([]byte{'-'})
+	}
+	return HashKey{Type: b.Type(), Value: h.Sum64()}
+}
+
+// 1 == 1.0, so a whole float is the same key as the integer with its value,
+// this also makes 0.0 and -0.0 the same key
+func (f *Float) HashKey() HashKey {
+	if f.Value == math.Trunc(f.Value) && !math.IsInf(f.Value, 0) {
+		if f.Value >= math.MinInt64 && f.Value < -math.MinInt64 {
+			return (&Integer{Value: int64(f.Value)}).HashKey()
+		}
+		i, _ := big.NewFloat(f.Value).Int(nil)
+		return (&BigInteger{Value: i}).HashKey()
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
 	return HashKey{Type: s.Type(), Value: h.Sum64()}
 }
 
+func (i *Integer) Compare(other Object) (int, bool) {
+	if o, ok := other.(*Integer); ok {
+		return cmp.Compare(i.Value, o.Value), true
+	}
+	return compareNumbers(i, other)
+}
+
+func (b *BigInteger) Compare(other Object) (int, bool) {
+	return compareNumbers(b, other)
+}
+
+func (f *Float) Compare(other Object) (int, bool) {
+	if o, ok := other.(*Float); ok {
+		if math.IsNaN(f.Value) || math.IsNaN(o.Value) {
+			return 0, false
+		}
+		return cmp.Compare(f.Value, o.Value), true
+	}
+	return compareNumbers(f, other)
+}
+
+func (s *String) Compare(other Object) (int, bool) {
+	if o, ok := other.(*String); ok {
+		return strings.Compare(s.Value, o.Value), true
+	}
+	return 0, false
+}
+
+// compares numbers of any kind exactly, without rounding big integers to float64
+func compareNumbers(a, b Object) (int, bool) {
+	x, ok := toBigFloat(a)
+	if !ok {
+		return 0, false
+	}
+	y, ok := toBigFloat(b)
+	if !ok {
+		return 0, false
+	}
+	return x.Cmp(y), true
+}
+
+func toBigFloat(obj Object) (*big.Float, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return new(big.Float).SetInt64(obj.Value), true
+	case *BigInteger:
+		return new(big.Float).SetInt(obj.Value), true
+	case *Float:
+		if math.IsNaN(obj.Value) {
+			return nil, false
+		}
+		return big.NewFloat(obj.Value), true
+	default:
+		return nil, false
+	}
+}
+
+type arrayIterator struct {
+	array *Array
+	idx   int
+}
+
+func (it *arrayIterator) Next() (Object, Object, bool) {
+	if it.idx >= len(it.array.Elements) {
+		return nil, nil, false
+	}
+	key := &Integer{Value: int64(it.idx)}
+	value := it.array.Elements[it.idx]
+	it.idx += 1
+	return key, value, true
+}
+
+// iterates over the characters of the string, the key is the index of the character
+type stringIterator struct {
+	value string
+	pos   int // byte offset of the next character
+	idx   int
+}
+
+func (it *stringIterator) Next() (Object, Object, bool) {
+	if it.pos >= len(it.value) {
+		return nil, nil, false
+	}
+	_, size := utf8.DecodeRuneInString(it.value[it.pos:])
+	key := &Integer{Value: int64(it.idx)}
+	value := &String{Value: it.value[it.pos : it.pos+size]}
+	it.pos += size
+	it.idx += 1
+	return key, value, true
+}
+
+type hashIterator struct {
+	pairs []HashPair
+	idx   int
+}
+
+func (it *hashIterator) Next() (Object, Object, bool) {
+	if it.idx >= len(it.pairs) {
+		return nil, nil, false
+	}
+	pair := it.pairs[it.idx]
+	it.idx += 1
+	return pair.Key, pair.Value, true
+}
+
+type rangeIterator struct {
+	rng  *Range
+	next int64
+	idx  int64
+	done bool
+}
+
+func (it *rangeIterator) Next() (Object, Object, bool) {
+	if it.done || !it.rng.contains(it.next) {
+		return nil, nil, false
+	}
+	key := &Integer{Value: it.idx}
+	value := &Integer{Value: it.next}
+
+	// stop instead of wrapping around when the next value overflows
+	next := it.next + it.rng.Step
+	it.done = (it.rng.Step > 0) != (next > it.next)
+	it.next = next
+	it.idx += 1
+	return key, value, true
+}
+
+func (ar *Array) Iterator() Iterator { return &arrayIterator{array: ar} }
+
+func (s *String) Iterator() Iterator { return &stringIterator{value: s.Value} }
+
+func (h *Hash) Iterator() Iterator { return &hashIterator{pairs: h.SortedPairs()} }
+
+func (r *Range) Iterator() Iterator { return &rangeIterator{rng: r, next: r.Start} }
+
+// pairs ordered by key, so iterating and printing hashes is deterministic
+// keys are grouped by type and ordered with Comparable inside each type
+func (h *Hash) SortedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair)
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		a, b := pairs[i].Key, pairs[j].Key
+		if a.Type() != b.Type() {
+			return a.Type() < b.Type()
+		}
+		if cmp, ok := a.(Comparable); ok {
+			if c, ok := cmp.Compare(b); ok {
+				return c < 0
+			}
+		}
+		return a.Inspect() < b.Inspect()
+	})
+
+	return pairs
+}
+
+func (r *Range) contains(v int64) bool {
+	if r.Step > 0 {
+		return v < r.End
+	}
+	return v > r.End
+}
+
+// number of values in the range, it does not always fit in an int64
+func (r *Range) Len() *big.Int {
+	if !r.contains(r.Start) {
+		return new(big.Int)
+	}
+	diff := new(big.Int).Sub(big.NewInt(r.End), big.NewInt(r.Start))
+	step := big.NewInt(r.Step)
+
+	// (diff - sign) / step + 1 is ceil(diff / step), diff and step have the same sign here
+	diff.Sub(diff, big.NewInt(int64(step.Sign())))
+	n := diff.Quo(diff, step)
+	return n.Add(n, big.NewInt(1))
+}
+
 func NewEnclosedEnviroment(outer *Enviroment) *Enviroment {
 	env := NewEnviroment()
 	env.outer = outer
+	env.legacyBlockScope = outer.legacyBlockScope
+	env.checkedArithmetic = outer.checkedArithmetic
 	return env
 }
 
 func NewEnviroment() *Enviroment {
 	s := make(map[string]Object)
-	return &Enviroment{store: s, outer: nil}
+	return &Enviroment{store: s, constants: make(map[string]bool), outer: nil}
 }
 
 func (e *Enviroment) Value(name string) (Object, bool) {
@@ -133,9 +403,64 @@ func (e *Enviroment) Value(name string) (Object, bool) {
 
 func (e *Enviroment) Add(name string, obj Object) Object {
 	e.store[name] = obj
+	delete(e.constants, name)
 	return obj
 }
 
+func (e *Enviroment) AddConst(name string, obj Object) Object {
+	e.store[name] = obj
+	e.constants[name] = true
+	return obj
+}
+
+// when on, if/else and while bodies run in the enclosing scope like they used to,
+// so a let inside them is still visible after the block ends
+// set it on the top level scope before evaluating, scopes enclosed later inherit it
+func (e *Enviroment) SetLegacyBlockScope(on bool) {
+	e.legacyBlockScope = on
+}
+
+func (e *Enviroment) LegacyBlockScope() bool {
+	return e.legacyBlockScope
+}
+
+// when on, integer results that do not fit in an int64 are errors instead of being promoted to BigInteger
+// set it on the top level scope before evaluating, scopes enclosed later inherit it
+func (e *Enviroment) SetCheckedArithmetic(on bool) {
+	e.checkedArithmetic = on
+}
+
+func (e *Enviroment) CheckedArithmetic() bool {
+	return e.checkedArithmetic
+}
+
+// reports whether the nearest binding of name is a constant
+func (e *Enviroment) IsConst(name string) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			return env.constants[name]
+		}
+	}
+	return false
+}
+
+// reports whether name is a constant declared in this scope, ignoring outer scopes
+func (e *Enviroment) IsLocalConst(name string) bool {
+	return e.constants[name]
+}
+
+// updates an existing binding in the nearest scope that declares name
+// ok is false when name is not declared anywhere
+func (e *Enviroment) Set(name string, obj Object) (Object, bool) {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			env.store[name] = obj
+			return obj, true
+		}
+	}
+	return nil, false
+}
+
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
@@ -145,7 +470,11 @@ func (f *Function) Inspect() string {
 		params = append(params, p.String())
 	}
 
-	out.WriteString("fn(")
+	out.WriteString("fn")
+	if f.Name != "" {
+		out.WriteString(" " + f.Name)
+	}
+	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") {\n")
 	out.WriteString(f.Body.String())
@@ -157,6 +486,28 @@ func (f *Function) Inspect() string {
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 
+// returns an Integer if v fits in an int64 and a BigInteger otherwise
+func NewBigInteger(v *big.Int) Object {
+	if v.IsInt64() {
+		return &Integer{Value: v.Int64()}
+	}
+	return &BigInteger{Value: v}
+}
+
+func (b *BigInteger) Type() ObjectType { return INTEGER_OBJ }
+func (b *BigInteger) Inspect() string  { return b.Value.String() }
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// always shows a decimal point or an exponent, so 2.0 is not mistaken for an integer
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
 func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
 func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
 
@@ -166,44 +517,105 @@ func (s *String) Inspect() string  { return s.Value }
 func (rt *Return) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rt *Return) Inspect() string  { return rt.Value.Inspect() }
 
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
 func (bt *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 func (bt *Builtin) Inspect() string  { return "builtin function" }
 
 func (ar *Array) Type() ObjectType { return ARRAY_OBJ }
-func (ar *Array) Inspect() string {
-	var out bytes.Buffer
+func (ar *Array) Inspect() string  { return inspect(ar, map[Object]bool{}) }
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string  { return inspect(h, map[Object]bool{}) }
 
-	e := []string{}
+// inspects arrays and hashes that may contain themselves, seen holds the ones
+// being printed and a repeated one is shown as [...] or {...}
+func inspect(obj Object, seen map[Object]bool) string {
+	var out bytes.Buffer
 
-	for _, el := range ar.Elements {
-		e = append(e, el.Inspect())
+	switch obj := obj.(type) {
+	case *Array:
+		if seen[obj] {
+			return "[...]"
+		}
+		seen[obj] = true
+		defer delete(seen, obj)
+
+		e := []string{}
+
+		for _, el := range obj.Elements {
+			e = append(e, inspect(el, seen))
+		}
+
+		out.WriteString("[")
+		out.WriteString(strings.Join(e, ", "))
+		out.WriteString("]")
+	case *Hash:
+		if seen[obj] {
+			return "{...}"
+		}
+		seen[obj] = true
+		defer delete(seen, obj)
+
+		pairs := []string{}
+
+		for _, pair := range obj.SortedPairs() {
+			pairs = append(pairs, fmt.Sprintf("%s: %s", inspect(pair.Key, seen), inspect(pair.Value, seen)))
+		}
+
+		out.WriteString("{")
+		out.WriteString(strings.Join(pairs, ", "))
+		out.WriteString("}")
+	default:
+		return obj.Inspect()
 	}
 
-	out.WriteString("[")
-	out.WriteString(strings.Join(e, ", "))
-	out.WriteString("]")
 	return out.String()
 }
 
-func (h *Hash) Type() ObjectType { return HASH_OBJ }
-func (h *Hash) Inspect() string {
-	var out bytes.Buffer
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+func (r *Range) Inspect() string {
+	return fmt.Sprintf("range(%d, %d, %d)", r.Start, r.End, r.Step)
+}
 
-	pairs := []string{}
+func (err *Error) Type() ObjectType { return ERROR_OBJ }
+func (err *Error) Inspect() string {
+	var out bytes.Buffer
 
-	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
+	out.WriteString("ERROR: ")
+	if err.Pos.IsValid() {
+		out.WriteString(err.Pos.String() + ": ")
+	}
+	out.WriteString(err.Value)
+
+	// one line per call, the same call repeated by recursion is only shown once
+	for i := 0; i < len(err.Trace); {
+		n := 1
+		for i+n < len(err.Trace) && err.Trace[i+n] == err.Trace[i] {
+			n++
+		}
+
+		out.WriteString("\n  " + err.Trace[i].String())
+		if n > 1 {
+			out.WriteString(fmt.Sprintf("\n  ... repeated %d more times", n-1))
+		}
+		i += n
 	}
-
-	out.WriteString("{")
-	out.WriteString(strings.Join(pairs, ", "))
-	out.WriteString("}")
 
 	return out.String()
 }
 
-func (err *Error) Type() ObjectType { return ERROR_OBJ }
-func (err *Error) Inspect() string  { return "ERROR: " + err.Value }
+func (f Frame) String() string {
+	name := f.Function
+	if name == "" {
+		name = "anonymous function"
+	}
+	return "in " + name + ", called at " + f.Pos.String()
+}
 
 func (n *Null) Type() ObjectType { return NULL_OBJ }
 func (n *Null) Inspect() string  { return "null" }
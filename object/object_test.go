@@ -1,6 +1,12 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"monkey/token"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -17,3 +23,241 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{1.5, "1.5"},
+		{2, "2.0"},
+		{-3, "-3.0"},
+		{1e-9, "1e-09"},
+		{1e21, "1e+21"},
+	}
+	for _, tt := range tests {
+		f := &Float{Value: tt.value}
+		if f.Inspect() != tt.expected {
+			t.Errorf("wrong inspect for %g. expected=%q, got=%q", tt.value, tt.expected, f.Inspect())
+		}
+	}
+}
+
+func TestBigIntegerHashKey(t *testing.T) {
+	a, _ := new(big.Int).SetString("100000000000000000000", 10)
+	b, _ := new(big.Int).SetString("100000000000000000000", 10)
+	neg := new(big.Int).Neg(a)
+
+	big1 := &BigInteger{Value: a}
+	big2 := &BigInteger{Value: b}
+	big3 := &BigInteger{Value: neg}
+	if big1.HashKey() != big2.HashKey() {
+		t.Errorf("big integers with same value have different hash keys")
+	}
+	if big1.HashKey() == big3.HashKey() {
+		t.Errorf("big integers with different sign have same hash keys")
+	}
+}
+
+func TestFloatHashKey(t *testing.T) {
+	big1, _ := new(big.Int).SetString("100000000000000000000", 10)
+	tests := []struct {
+		float *Float
+		other Object
+		same  bool
+	}{
+		{&Float{Value: 1.5}, &Float{Value: 1.5}, true},
+		{&Float{Value: 0}, &Float{Value: math.Copysign(0, -1)}, true},
+		{&Float{Value: 1}, &Integer{Value: 1}, true},
+		{&Float{Value: -3}, &Integer{Value: -3}, true},
+		{&Float{Value: 1e20}, &BigInteger{Value: big1}, true},
+		{&Float{Value: 1.5}, &Integer{Value: 1}, false},
+		{&Float{Value: 1}, &Float{Value: 2}, false},
+		{&Float{Value: math.Inf(1)}, &Float{Value: math.Inf(-1)}, false},
+	}
+
+	for _, tt := range tests {
+		if same := tt.float.HashKey() == tt.other.(Hashable).HashKey(); same != tt.same {
+			t.Errorf("hash keys of %s and %s: expected same=%t, got=%t", tt.float.Inspect(), tt.other.Inspect(), tt.same, same)
+		}
+	}
+}
+
+func TestNewBigInteger(t *testing.T) {
+	if _, ok := NewBigInteger(big.NewInt(42)).(*Integer); !ok {
+		t.Errorf("small value was not demoted to Integer")
+	}
+	v, _ := new(big.Int).SetString("9223372036854775808", 10)
+	if _, ok := NewBigInteger(v).(*BigInteger); !ok {
+		t.Errorf("value beyond int64 was not kept as BigInteger")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	huge, _ := new(big.Int).SetString("100000000000000000000", 10)
+
+	tests := []struct {
+		left     Comparable
+		right    Object
+		expected int
+		ok       bool
+	}{
+		{&Integer{Value: 1}, &Integer{Value: 2}, -1, true},
+		{&Integer{Value: 2}, &Float{Value: 1.5}, 1, true},
+		{&Float{Value: 2}, &Integer{Value: 2}, 0, true},
+		{&BigInteger{Value: huge}, &Integer{Value: 2}, 1, true},
+		{&Float{Value: 1e30}, &BigInteger{Value: huge}, 1, true},
+		{&String{Value: "a"}, &String{Value: "b"}, -1, true},
+		{&String{Value: "a"}, &Integer{Value: 1}, 0, false},
+		{&Float{Value: math.NaN()}, &Float{Value: 1}, 0, false},
+	}
+	for i, tt := range tests {
+		c, ok := tt.left.Compare(tt.right)
+		if ok != tt.ok {
+			t.Errorf("tests[%d] - ok wrong. expected=%t, got=%t", i, tt.ok, ok)
+			continue
+		}
+		if ok && c != tt.expected {
+			t.Errorf("tests[%d] - result wrong. expected=%d, got=%d", i, tt.expected, c)
+		}
+	}
+}
+
+func TestRangeIterator(t *testing.T) {
+	tests := []struct {
+		rng      *Range
+		expected []int64
+	}{
+		{&Range{Start: 0, End: 5, Step: 2}, []int64{0, 2, 4}},
+		{&Range{Start: 3, End: 0, Step: -1}, []int64{3, 2, 1}},
+		{&Range{Start: 0, End: 0, Step: 1}, []int64{}},
+		{&Range{Start: math.MaxInt64 - 1, End: math.MaxInt64, Step: 5}, []int64{math.MaxInt64 - 1}},
+	}
+	for i, tt := range tests {
+		got := []int64{}
+		iter := tt.rng.Iterator()
+		for {
+			_, v, ok := iter.Next()
+			if !ok {
+				break
+			}
+			got = append(got, v.(*Integer).Value)
+		}
+		if len(got) != len(tt.expected) {
+			t.Errorf("tests[%d] - wrong values. expected=%v, got=%v", i, tt.expected, got)
+			continue
+		}
+		for j := range got {
+			if got[j] != tt.expected[j] {
+				t.Errorf("tests[%d] - wrong values. expected=%v, got=%v", i, tt.expected, got)
+			}
+		}
+		if tt.rng.Len().Int64() != int64(len(tt.expected)) {
+			t.Errorf("tests[%d] - wrong len. expected=%d, got=%s", i, len(tt.expected), tt.rng.Len())
+		}
+	}
+}
+
+func TestHashSortedPairs(t *testing.T) {
+	h := &Hash{Pairs: map[HashKey]HashPair{}}
+	for _, key := range []Object{&String{Value: "b"}, &Integer{Value: 10}, &String{Value: "a"}, &Integer{Value: 2}} {
+		h.Pairs[key.(Hashable).HashKey()] = HashPair{Key: key, Value: key}
+	}
+
+	expected := "{2: 2, 10: 10, a: a, b: b}"
+	if h.Inspect() != expected {
+		t.Errorf("wrong inspect. expected=%q, got=%q", expected, h.Inspect())
+	}
+}
+
+func TestEnviromentSet(t *testing.T) {
+	outer := NewEnviroment()
+	outer.Add("x", &Integer{Value: 1})
+	inner := NewEnclosedEnviroment(outer)
+
+	if _, ok := inner.Set("x", &Integer{Value: 2}); !ok {
+		t.Fatalf("Set did not find x in the outer scope")
+	}
+	if _, ok := inner.store["x"]; ok {
+		t.Errorf("Set created a binding in the inner scope")
+	}
+	if v, _ := outer.Value("x"); v.(*Integer).Value != 2 {
+		t.Errorf("outer x not updated. got=%s", v.Inspect())
+	}
+	if _, ok := inner.Set("y", &Integer{Value: 1}); ok {
+		t.Errorf("Set succeeded for an undeclared name")
+	}
+}
+
+func TestEnviromentLegacyBlockScope(t *testing.T) {
+	env := NewEnviroment()
+	if env.LegacyBlockScope() {
+		t.Fatalf("legacy block scope is on by default")
+	}
+
+	env.SetLegacyBlockScope(true)
+	inner := NewEnclosedEnviroment(NewEnclosedEnviroment(env))
+	if !inner.LegacyBlockScope() {
+		t.Errorf("enclosed scope did not inherit legacy block scope")
+	}
+}
+
+func TestEnviromentCheckedArithmetic(t *testing.T) {
+	env := NewEnviroment()
+	if env.CheckedArithmetic() {
+		t.Fatalf("checked arithmetic is on by default")
+	}
+
+	env.SetCheckedArithmetic(true)
+	inner := NewEnclosedEnviroment(NewEnclosedEnviroment(env))
+	if !inner.CheckedArithmetic() {
+		t.Errorf("enclosed scope did not inherit checked arithmetic")
+	}
+}
+
+func TestEnviromentConstants(t *testing.T) {
+	outer := NewEnviroment()
+	outer.AddConst("x", &Integer{Value: 1})
+	inner := NewEnclosedEnviroment(outer)
+
+	if !inner.IsConst("x") || inner.IsLocalConst("x") {
+		t.Errorf("x should be a constant of the outer scope only")
+	}
+
+	inner.Add("x", &Integer{Value: 2})
+	if inner.IsConst("x") {
+		t.Errorf("a let in the inner scope should shadow the outer constant")
+	}
+
+	outer.Add("x", &Integer{Value: 3})
+	if outer.IsConst("x") {
+		t.Errorf("Add should replace the constant binding")
+	}
+}
+
+func TestErrorInspect(t *testing.T) {
+	call := token.Position{Filename: "a.mk", Line: 3, Column: 5}
+	err := &Error{
+		Value: "division by zero: 1 / 0",
+		Pos:   token.Position{Filename: "a.mk", Line: 1, Column: 20},
+		Trace: []Frame{
+			{Function: "f", Pos: call},
+			{Function: "f", Pos: call},
+			{Function: "f", Pos: call},
+			{Pos: token.Position{Filename: "a.mk", Line: 7, Column: 1}},
+		},
+	}
+
+	expected := `ERROR: a.mk:1:20: division by zero: 1 / 0
+  in f, called at a.mk:3:5
+  ... repeated 2 more times
+  in anonymous function, called at a.mk:7:1`
+	if err.Inspect() != expected {
+		t.Errorf("wrong inspect. expected=%q, got=%q", expected, err.Inspect())
+	}
+
+	err = &Error{Value: "boom"}
+	if err.Inspect() != "ERROR: boom" {
+		t.Errorf("wrong inspect. got=%q", err.Inspect())
+	}
+}
@@ -1,7 +1,10 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
+	"slices"
 	"strconv"
 
 	"monkey/ast"
@@ -12,10 +15,18 @@ import (
 const (
 	_ int = iota // assign values 1 to 7 for the constants to get precedence
 	LOWEST
+	ARROW       // x => x
+	ASSIGN      // = OR += OR -= OR *= OR /=
+	TERNARY     // ? :
+	PIPE        // |>
+	NULLISH     // ??
+	OR          // ||
+	AND         // &&
 	EQUALS      // ==
-	LESSGREATER // > OR <
+	LESSGREATER // > OR < OR >= OR <=
 	SUM         // +
 	PRODUCT     // *
+	POWER       // **
 	PREFIX      // -X OR !X
 	CALL        // MyFunction(x)
 	INDEX       // [1]
@@ -23,16 +34,33 @@ const (
 
 // precedence table to map token type to precedence
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:           ASSIGN,
+	token.PLUS_ASSIGN:      ASSIGN,
+	token.MINUS_ASSIGN:     ASSIGN,
+	token.ASTERISK_ASSIGN:  ASSIGN,
+	token.SLASH_ASSIGN:     ASSIGN,
+	token.ARROW:            ARROW,
+	token.PIPE:             PIPE,
+	token.QUESTION:         TERNARY,
+	token.NULLISH:          NULLISH,
+	token.OR:               OR,
+	token.AND:              AND,
+	token.EQ:               EQUALS,
+	token.NOT_EQ:           EQUALS,
+	token.LT:               LESSGREATER,
+	token.GT:               LESSGREATER,
+	token.LT_EQ:            LESSGREATER,
+	token.GT_EQ:            LESSGREATER,
+	token.PLUS:             SUM,
+	token.MINUS:            SUM,
+	token.SLASH:            PRODUCT,
+	token.ASTERISK:         PRODUCT,
+	token.PERCENT:          PRODUCT,
+	token.POWER:            POWER,
+	token.LPAREN:           CALL,
+	token.LBRACKET:         INDEX,
+	token.OPTIONAL_DOT:     INDEX,
+	token.OPTIONAL_BRACKET: INDEX,
 }
 
 type (
@@ -49,6 +77,12 @@ type Parser struct {
 	errors    []string
 	curToken  token.Token
 	peekToken token.Token
+	loopDepth int // number of loops around the current token, break and continue need at least one
+
+	// set by a syntax error until the parser skips to the end of the statement,
+	// errors in between are not reported because they are usually caused by the first one
+	panicking bool
+	depth     int // number of { not yet closed before the current token
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -63,27 +97,50 @@ func NewParser(l *lexer.Lexer) (p *Parser) {
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.regPrefix(token.IDENT, p.parseIdentifier)
 	p.regPrefix(token.INT, p.parseInteger)
+	p.regPrefix(token.FLOAT, p.parseFloat)
 	p.regPrefix(token.STRING, p.parseString)
 	p.regPrefix(token.BANG, p.parsePrefixExpression)
 	p.regPrefix(token.MINUS, p.parsePrefixExpression)
 	p.regPrefix(token.TRUE, p.parseBoolean)
 	p.regPrefix(token.FALSE, p.parseBoolean)
+	p.regPrefix(token.NULL, p.parseNull)
 	p.regPrefix(token.LPAREN, p.parseGroupedExpressions)
 	p.regPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.regPrefix(token.IF, p.parseIfExpression)
+	p.regPrefix(token.MATCH, p.parseMatchExpression)
+	p.regPrefix(token.ELLIPSIS, p.parseSpreadExpression)
 	p.regPrefix(token.LBRACKET, p.parseArray)
 	p.regPrefix(token.LBRACE, p.parseHashLiteral)
+	p.regPrefix(token.ILLEGAL, p.parseIllegal)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.regInfix(token.PLUS, p.parseInfixExpression)
 	p.regInfix(token.MINUS, p.parseInfixExpression)
 	p.regInfix(token.SLASH, p.parseInfixExpression)
 	p.regInfix(token.ASTERISK, p.parseInfixExpression)
+	p.regInfix(token.PERCENT, p.parseInfixExpression)
+	p.regInfix(token.POWER, p.parseInfixExpression)
 	p.regInfix(token.EQ, p.parseInfixExpression)
 	p.regInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.regInfix(token.LT, p.parseInfixExpression)
 	p.regInfix(token.GT, p.parseInfixExpression)
+	p.regInfix(token.LT_EQ, p.parseInfixExpression)
+	p.regInfix(token.GT_EQ, p.parseInfixExpression)
+	p.regInfix(token.AND, p.parseInfixExpression)
+	p.regInfix(token.OR, p.parseInfixExpression)
+	p.regInfix(token.NULLISH, p.parseInfixExpression)
+	p.regInfix(token.QUESTION, p.parseConditionalExpression)
+	p.regInfix(token.ARROW, p.parseArrowFunction)
+	p.regInfix(token.PIPE, p.parsePipeExpression)
+	p.regInfix(token.ASSIGN, p.parseAssignExpression)
+	p.regInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.regInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.regInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.regInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
 	p.regInfix(token.LPAREN, p.parseCallExpression)
 	p.regInfix(token.LBRACKET, p.parseIndexExpression)
+	p.regInfix(token.OPTIONAL_BRACKET, p.parseIndexExpression)
+	p.regInfix(token.OPTIONAL_DOT, p.parseOptionalField)
 
 	p.nextToken() // initializes next token
 	p.nextToken() // initializes curr token
@@ -113,18 +170,85 @@ func (p *Parser) regInfix(tt token.TokenType, fn infixParseFn) {
 	p.infixParseFns[tt] = fn
 }
 
+// lexer diagnostics followed by parser errors
 func (p *Parser) Errors() []string {
-	return p.errors
+	return slices.Concat(p.l.Errors(), p.errors)
+}
+
+// records an error message prefixed with the position it refers to
+func (p *Parser) addError(pos token.Position, format string, a ...interface{}) {
+	if p.panicking {
+		return
+	}
+	msg := fmt.Sprintf(format, a...)
+	p.errors = append(p.errors, pos.String()+": "+msg)
+}
+
+// an error that leaves the statement without a usable tree, like a missing token or an invalid literal,
+// the statement is dropped and the parser skips to its end, see synchronize
+func (p *Parser) syntaxError(pos token.Position, format string, a ...interface{}) {
+	if p.panicking {
+		return
+	}
+	p.addError(pos, format, a...)
+	p.panicking = true
 }
 
 func (p *Parser) peekError(tk token.TokenType) {
-	err := fmt.Sprintf("expected next token to be %s, got %s instead", tk, p.peekToken.Type)
-	p.errors = append(p.errors, err)
+	p.syntaxError(p.peekToken.Pos, "expected next token to be %s, got %s instead", tk, p.peekToken.Type)
+}
+
+// skips the rest of a statement with a syntax error, up to a ; or a block end, or before a } or a keyword that starts a statement,
+// depth is the nesting of the statement, braces opened inside it are skipped as a whole, start is its first token
+// returns false when the current token must not be skipped, because it starts the next statement
+// or is the } that closes the enclosing block
+func (p *Parser) synchronize(depth int, start token.Token) bool {
+	p.panicking = false
+
+	for p.curToken.Type != token.EOF {
+		if p.depth < depth {
+			return false
+		}
+
+		if p.depth == depth {
+			// the bad token can be the keyword of the next statement, like in let x = \n let y = 1
+			if statementKeywords[p.curToken.Type] && p.curToken.Pos != start.Pos {
+				return false
+			}
+			if p.curToken.Type == token.SEMICOLON {
+				return true
+			}
+			// the end of a block like the body of if or while usually ends the statement too
+			if p.curToken.Type == token.RBRACE && p.peekToken.Type != token.SEMICOLON {
+				return true
+			}
+			if p.peekToken.Type == token.RBRACE || statementKeywords[p.peekToken.Type] {
+				return true
+			}
+		}
+		p.nextToken()
+	}
+	return true
 }
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	// comments are trivia, they are only kept by the lexer for tools like formatters
+	for p.peekToken.Type == token.COMMENT {
+		p.peekToken = p.l.NextToken()
+	}
+
+	switch p.curToken.Type {
+	case token.LBRACE:
+		p.depth++
+	case token.RBRACE:
+		// a stray } at the top level does not make the program less nested
+		if p.depth > 0 {
+			p.depth--
+		}
+	}
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -132,9 +256,15 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program.Statements = []ast.Statement{}
 
 	for p.curToken.Type != token.EOF {
+		start := p.curToken
 		st := p.parseStatement()
 
-		if st != nil {
+		// statements with a syntax error are left out, the rest of the program is still parsed
+		if p.panicking {
+			if !p.synchronize(0, start) {
+				continue
+			}
+		} else if st != nil {
 			program.Statements = append(program.Statements, st)
 		}
 		p.nextToken()
@@ -142,20 +272,80 @@ func (p *Parser) ParseProgram() *ast.Program {
 	return program
 }
 
+// keywords that can only start a statement, where synchronize stops skipping
+var statementKeywords = map[token.TokenType]bool{
+	token.LET:      true,
+	token.CONST:    true,
+	token.RETURN:   true,
+	token.WHILE:    true,
+	token.FOR:      true,
+	token.BREAK:    true,
+	token.CONTINUE: true,
+	token.TRY:      true,
+	token.THROW:    true,
+}
+
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
-	case token.LET:
-		return p.parseLetStatement()
+	case token.LET, token.CONST:
+		return statement(p.parseLetStatement())
 	case token.RETURN:
-		return p.parseReturnStatement()
+		return statement(p.parseReturnStatement())
 	case token.IF:
-		return p.parseIfStatement()
+		return statement(p.parseIfStatement())
+	case token.WHILE:
+		return statement(p.parseWhileStatement())
+	case token.FOR:
+		return statement(p.parseForStatement())
+	case token.BREAK:
+		return statement(p.parseBreakStatement())
+	case token.CONTINUE:
+		return statement(p.parseContinueStatement())
+	case token.TRY:
+		return statement(p.parseTryStatement())
+	case token.THROW:
+		return statement(p.parseThrowStatement())
+	case token.FUNCTION:
+		if p.peekToken.Type == token.IDENT {
+			return statement(p.parseFunctionDeclaration())
+		}
+		return statement(p.parseExpressionStatement())
 	default:
-		return p.parseExpressionStatement()
+		return statement(p.parseExpressionStatement())
 	}
 }
 
+// keeps a nil *ast.LetStatement and the like from becoming a non nil ast.Statement
+func statement[T any, PT interface {
+	*T
+	ast.Statement
+}](st PT) ast.Statement {
+	if st == nil {
+		return nil
+	}
+	return st
+}
+
+// if at the start of a statement, a trailing semicolon is optional
 func (p *Parser) parseIfStatement() *ast.IfStatement {
+	is := p.parseIf()
+
+	if is != nil && p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+
+	return is
+}
+
+// if in any other position, its value is the value of the branch that runs
+func (p *Parser) parseIfExpression() ast.Expression {
+	if is := p.parseIf(); is != nil {
+		return is
+	}
+	return nil
+}
+
+func (p *Parser) parseIf() *ast.IfStatement {
 	is := &ast.IfStatement{Token: p.curToken}
 
 	if !p.expectPeek(token.LPAREN) {
@@ -179,6 +369,22 @@ func (p *Parser) parseIfStatement() *ast.IfStatement {
 	if p.peekToken.Type == token.ELSE {
 		p.nextToken()
 
+		// else if chains become an alternative block holding the nested if
+		if p.peekToken.Type == token.IF {
+			p.nextToken()
+
+			block := &ast.BlockStatement{Token: p.curToken}
+			nested := p.parseIf()
+			if nested == nil {
+				return nil
+			}
+			block.Statements = []ast.Statement{nested}
+			block.Rbrace = p.curToken
+			is.Alternative = block
+
+			return is
+		}
+
 		if !p.expectPeek(token.LBRACE) {
 			return nil
 		}
@@ -189,16 +395,324 @@ func (p *Parser) parseIfStatement() *ast.IfStatement {
 	return is
 }
 
-func (p *Parser) parseLetStatement() *ast.LetStatement {
-	st := &ast.LetStatement{Token: p.curToken}
+func (p *Parser) parseMatchExpression() ast.Expression {
+	me := &ast.MatchExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	me.Subject = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for p.peekToken.Type != token.RBRACE && p.peekToken.Type != token.EOF {
+		p.nextToken()
+
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		me.Arms = append(me.Arms, arm)
+
+		// arms are separated by commas, the comma is optional after a block body
+		if p.peekToken.Type == token.COMMA {
+			p.nextToken()
+		} else if _, ok := arm.Body.(*ast.BlockStatement); !ok && p.peekToken.Type != token.RBRACE {
+			p.peekError(token.COMMA)
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	me.Rbrace = p.curToken
+
+	return me
+}
+
+// a body starting with { is a block, a hash literal body has to be wrapped in parentheses
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	// patterns and guards stop before the =>, so it isn't parsed as an arrow function
+	arm := &ast.MatchArm{Pattern: p.parseExpression(ARROW)}
+	if !p.checkPattern(arm.Pattern) {
+		return nil
+	}
+
+	if p.peekToken.Type == token.IF {
+		p.nextToken()
+		p.nextToken()
+		arm.Guard = p.parseExpression(ARROW)
+	}
+
+	if !p.expectPeek(token.ARROW) {
+		return nil
+	}
+
+	if p.peekToken.Type == token.LBRACE {
+		p.nextToken()
+		arm.Body = p.parseBlockStatement()
+		return arm
+	}
+
+	p.nextToken()
+	body := p.parseExpression(LOWEST)
+	if body == nil {
+		return nil
+	}
+	arm.Body = body
+
+	return arm
+}
+
+// reports an error when pattern can't be used to match or bind values
+func (p *Parser) checkPattern(pattern ast.Expression) bool {
+	switch pt := pattern.(type) {
+	case nil:
+		// the expression itself failed to parse and was already reported
+		return false
+	case *ast.Identifier, *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Boolean, *ast.NullLiteral:
+		return true
+	case *ast.PrefixExpression:
+		// negative numbers
+		switch pt.Right.(type) {
+		case *ast.IntegerLiteral, *ast.FloatLiteral:
+			if pt.Operator == "-" {
+				return true
+			}
+		}
+	case *ast.ArrayLiteral:
+		for i, el := range pt.Elements {
+			spread, ok := el.(*ast.SpreadExpression)
+			if !ok {
+				if !p.checkPattern(el) {
+					return false
+				}
+				continue
+			}
+			if i != len(pt.Elements)-1 {
+				p.syntaxError(spread.Pos(), "rest pattern must be the last element")
+				return false
+			}
+			if _, ok := spread.Value.(*ast.Identifier); !ok {
+				p.syntaxError(spread.Pos(), "rest pattern must be an identifier, got %s", spread.Value)
+				return false
+			}
+		}
+		return true
+	case *ast.HashLiteral:
+		for k, v := range pt.Pairs {
+			switch k.(type) {
+			case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+			default:
+				p.syntaxError(k.Pos(), "hash pattern keys must be literals, got %s", k)
+				return false
+			}
+			if !p.checkPattern(v) {
+				return false
+			}
+		}
+		return true
+	}
+
+	p.syntaxError(pattern.Pos(), "invalid pattern: %s", pattern)
+	return false
+}
+
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	ws := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+
+	ws.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	p.loopDepth += 1
+	ws.Body = p.parseBlockStatement()
+	p.loopDepth -= 1
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+	return ws
+}
+
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	fs := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
 
-	// verify if token type is IDENTIFIER
 	if !p.expectPeek(token.IDENT) {
 		return nil
 	}
+	fs.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	// two variables, the first one is the key and the second the value
+	if p.peekToken.Type == token.COMMA {
+		p.nextToken()
+
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		fs.Key = fs.Value
+		fs.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+
+	fs.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	p.loopDepth += 1
+	fs.Body = p.parseBlockStatement()
+	p.loopDepth -= 1
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+	return fs
+}
+
+func (p *Parser) parseTryStatement() *ast.TryStatement {
+	ts := &ast.TryStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	ts.Block = p.parseBlockStatement()
+
+	if p.peekToken.Type == token.CATCH {
+		p.nextToken()
+
+		// catch { } runs without binding the error
+		if p.peekToken.Type == token.LPAREN {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			ts.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if !p.expectPeek(token.RPAREN) {
+				return nil
+			}
+		}
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		ts.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekToken.Type == token.FINALLY {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		ts.Finally = p.parseBlockStatement()
+	}
+
+	if ts.Catch == nil && ts.Finally == nil {
+		p.addError(ts.Token.Pos, "try without catch or finally")
+		return nil
+	}
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+	return ts
+}
+
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	st := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	st.Value = p.parseExpression(LOWEST)
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+	return st
+}
+
+func (p *Parser) parseBreakStatement() *ast.BreakStatement {
+	st := &ast.BreakStatement{Token: p.curToken}
+
+	if p.loopDepth == 0 {
+		p.addError(p.curToken.Pos, "break outside loop")
+	}
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+	return st
+}
+
+func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
+	st := &ast.ContinueStatement{Token: p.curToken}
+
+	if p.loopDepth == 0 {
+		p.addError(p.curToken.Pos, "continue outside loop")
+	}
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+	return st
+}
+
+func (p *Parser) parseLetStatement() *ast.LetStatement {
+	st := &ast.LetStatement{Token: p.curToken}
+
+	switch p.peekToken.Type {
+	case token.LBRACKET, token.LBRACE:
+		// destructuring, the pattern stops before the = so it isn't parsed as an assignment
+		p.nextToken()
+		st.Pattern = p.parseExpression(ASSIGN)
+		if !p.checkPattern(st.Pattern) {
+			return nil
+		}
+	default:
+		// verify if token type is IDENTIFIER
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
 
-	// create identifier node
-	st.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		// create identifier node
+		st.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
 
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
@@ -208,6 +722,11 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	st.Value = p.parseExpression(LOWEST)
 
+	// let f = fn() {} names the function after the binding
+	if fn, ok := st.Value.(*ast.FunctionLiteral); ok && st.Name != nil {
+		fn.Name = st.Name.Value
+	}
+
 	if p.peekToken.Type == token.SEMICOLON {
 		p.nextToken()
 	}
@@ -245,15 +764,33 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
 
+	// errors inside the block are its own, an error before it still drops the statement around it
+	panicking := p.panicking
+	p.panicking = false
+
+	depth := p.depth
 	p.nextToken()
 
 	for p.curToken.Type != token.RBRACE && p.curToken.Type != token.EOF {
+		start := p.curToken
 		st := p.parseStatement()
-		if st != nil {
+		if p.panicking {
+			advance := p.synchronize(depth, start)
+			// the bad statement went past the } of the block
+			if p.depth < depth {
+				break
+			}
+			if !advance {
+				continue
+			}
+		} else if st != nil {
 			block.Statements = append(block.Statements, st)
 		}
 		p.nextToken()
 	}
+	block.Rbrace = p.curToken
+
+	p.panicking = panicking
 	return block
 }
 
@@ -266,9 +803,14 @@ func (p *Parser) parseInteger() ast.Expression {
 	intLiteral := &ast.IntegerLiteral{Token: p.curToken}
 
 	val, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		if big, ok := new(big.Int).SetString(p.curToken.Literal, 0); ok {
+			intLiteral.Big = big
+			return intLiteral
+		}
+	}
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as int", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.syntaxError(p.curToken.Pos, "could not parse %q as int", p.curToken.Literal)
 		return nil
 	}
 	intLiteral.Value = val
@@ -276,12 +818,27 @@ func (p *Parser) parseInteger() ast.Expression {
 	return intLiteral
 }
 
+func (p *Parser) parseFloat() ast.Expression {
+	floatLiteral := &ast.FloatLiteral{Token: p.curToken}
+
+	val, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		p.syntaxError(p.curToken.Pos, "could not parse %q as float", p.curToken.Literal)
+		return nil
+	}
+	floatLiteral.Value = val
+
+	return floatLiteral
+}
+
 func (p *Parser) parseArray() ast.Expression {
 	a := &ast.ArrayLiteral{Token: p.curToken}
 	l := []ast.Expression{}
 
 	if p.peekToken.Type == token.RBRACKET {
 		p.nextToken()
+		a.Elements = l
+		a.Rbracket = p.curToken
 		return a
 	}
 
@@ -294,26 +851,36 @@ func (p *Parser) parseArray() ast.Expression {
 		l = append(l, p.parseExpression(LOWEST))
 	}
 
-	if p.peekToken.Type != token.RBRACKET {
-		p.nextToken()
-		l = nil
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
 	}
-	p.nextToken()
 	a.Elements = l
+	a.Rbracket = p.curToken
 	return a
 }
 
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	e := &ast.IndexExpression{Token: p.curToken, Left: left}
+	e := &ast.IndexExpression{Token: p.curToken, Left: left, Optional: p.curToken.Type == token.OPTIONAL_BRACKET}
 
 	p.nextToken()
 	e.Index = p.parseExpression(LOWEST)
 
-	if p.peekToken.Type != token.RBRACKET {
-		p.nextToken()
+	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
-	p.nextToken()
+	e.Rbracket = p.curToken
+
+	return e
+}
+
+// a?.name is a?["name"]
+func (p *Parser) parseOptionalField(left ast.Expression) ast.Expression {
+	e := &ast.IndexExpression{Token: p.curToken, Left: left, Optional: true}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	e.Index = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 
 	return e
 }
@@ -326,35 +893,32 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		key := p.parseExpression(LOWEST)
 
-		if p.peekToken.Type != token.COLON {
-			p.nextToken()
+		if !p.expectPeek(token.COLON) {
 			return nil
 		}
 
-		p.nextToken()
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
 
 		hash.Pairs[key] = value
 
-		if p.peekToken.Type != token.RBRACE {
-			if p.peekToken.Type != token.COMMA {
-				p.nextToken()
-				return nil
-			}
-			p.nextToken()
+		if p.peekToken.Type != token.RBRACE && !p.expectPeek(token.COMMA) {
+			return nil
 		}
 	}
 
-	if p.peekToken.Type != token.RBRACE {
-		p.nextToken()
-		return nil
-	}
-
 	p.nextToken()
+	hash.Rbrace = p.curToken
 	return hash
 }
 
+// the lexer already reported why the token is illegal, so no error is added here,
+// but the statement is still dropped like after any other syntax error
+func (p *Parser) parseIllegal() ast.Expression {
+	p.panicking = true
+	return nil
+}
+
 func (p *Parser) parseString() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
@@ -367,6 +931,19 @@ func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.curToken, Value: value}
 }
 
+func (p *Parser) parseSpreadExpression() ast.Expression {
+	se := &ast.SpreadExpression{Token: p.curToken}
+
+	p.nextToken()
+	se.Value = p.parseExpression(PREFIX)
+
+	return se
+}
+
+func (p *Parser) parseNull() ast.Expression {
+	return &ast.NullLiteral{Token: p.curToken}
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	// creates a prefix operation node
 	expression := &ast.PrefixExpression{
@@ -390,22 +967,203 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	precedence := p.curPrecedence()
+
+	// ** is right associative, 2 ** 3 ** 2 is 2 ** (3 ** 2)
+	if expression.Token.Type == token.POWER {
+		precedence -= 1
+	}
+
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
 
 	return expression
 }
 
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token:    p.curToken,
+		Target:   target,
+		Operator: p.curToken.Literal,
+	}
+
+	switch target := target.(type) {
+	case nil:
+		// the target did not parse, its error is already reported
+		return nil
+	case *ast.Identifier:
+	case *ast.IndexExpression:
+		if target.Optional {
+			p.syntaxError(p.curToken.Pos, "cannot assign to optional access %s", target.String())
+			return nil
+		}
+	default:
+		p.syntaxError(p.curToken.Pos, "cannot assign to %s", target.String())
+		return nil
+	}
+
+	// assignment is right associative, a = b = 5 assigns 5 to b and then to a
+	p.nextToken()
+	expression.Value = p.parseExpression(LOWEST)
+	if expression.Value == nil {
+		return nil
+	}
+
+	return expression
+}
+
+func (p *Parser) parseConditionalExpression(condition ast.Expression) ast.Expression {
+	expression := &ast.ConditionalExpression{Token: p.curToken, Condition: condition}
+
+	p.nextToken()
+	expression.Consequence = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.COLON) {
+		return nil
+	}
+
+	// right associative, a ? b : c ? d : e is a ? b : (c ? d : e)
+	p.nextToken()
+	expression.Alternative = p.parseExpression(TERNARY - 1)
+
+	return expression
+}
+
+// also the parameter list of (a, b) => a + b
 func (p *Parser) parseGroupedExpressions() ast.Expression {
+	lparen := p.curToken
+
+	if p.peekToken.Type == token.RPAREN {
+		p.nextToken()
+		if p.peekToken.Type != token.ARROW {
+			p.peekError(token.ARROW)
+			return nil
+		}
+		return p.parseArrowParameters(lparen, []ast.Expression{})
+	}
+
 	p.nextToken()
 
 	expression := p.parseExpression(LOWEST)
+	if p.peekToken.Type != token.COMMA && p.peekToken.Type != token.RPAREN {
+		p.peekError(token.RPAREN)
+		return nil
+	}
+
+	if p.peekToken.Type == token.RPAREN {
+		p.nextToken()
+		if p.peekToken.Type == token.ARROW {
+			return p.parseArrowParameters(lparen, []ast.Expression{expression})
+		}
+		return expression
+	}
+
+	// more than one expression can only be a parameter list
+	params := []ast.Expression{expression}
+	for p.peekToken.Type == token.COMMA {
+		p.nextToken()
+		p.nextToken()
+		params = append(params, p.parseExpression(LOWEST))
+	}
 
-	if p.peekToken.Type != token.RPAREN {
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if p.peekToken.Type != token.ARROW {
+		p.peekError(token.ARROW)
 		return nil
 	}
+	return p.parseArrowParameters(lparen, params)
+}
+
+// checks the expressions of (a, b) before a => and parses the arrow function
+func (p *Parser) parseArrowParameters(lparen token.Token, params []ast.Expression) ast.Expression {
+	for _, param := range params {
+		switch param := param.(type) {
+		case *ast.Identifier:
+		case *ast.AssignExpression:
+			if _, ok := param.Target.(*ast.Identifier); !ok || param.Operator != "=" {
+				p.syntaxError(param.Pos(), "invalid parameter %s", param)
+				return nil
+			}
+		case *ast.SpreadExpression:
+			if _, ok := param.Value.(*ast.Identifier); !ok {
+				p.syntaxError(param.Pos(), "invalid parameter %s", param)
+				return nil
+			}
+		case *ast.ArrayLiteral, *ast.HashLiteral:
+			if !p.checkPattern(param) {
+				return nil
+			}
+		case nil:
+			return nil
+		default:
+			p.syntaxError(param.Pos(), "invalid parameter %s", param)
+			return nil
+		}
+	}
+	p.checkParameters(params)
+
 	p.nextToken()
-	return expression
+	return p.parseArrowBody(params)
+}
+
+// x => x * 2, the single parameter case where the left side is already parsed
+func (p *Parser) parseArrowFunction(left ast.Expression) ast.Expression {
+	ident, ok := left.(*ast.Identifier)
+	if !ok {
+		p.syntaxError(p.curToken.Pos, "invalid arrow function parameters %s", left)
+		return nil
+	}
+	return p.parseArrowBody([]ast.Expression{ident})
+}
+
+// called with the => token as curToken, a body starting with { is a block
+func (p *Parser) parseArrowBody(params []ast.Expression) ast.Expression {
+	fn := &ast.FunctionLiteral{Token: p.curToken, Arguments: params}
+
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
+	defer func() { p.loopDepth = loopDepth }()
+
+	if p.peekToken.Type == token.LBRACE {
+		p.nextToken()
+		fn.Body = p.parseBlockStatement()
+		return fn
+	}
+
+	p.nextToken()
+	start := p.curToken
+	body := p.parseExpression(LOWEST)
+	if body == nil {
+		return nil
+	}
+	fn.Body = &ast.BlockStatement{
+		Token:      fn.Token,
+		Statements: []ast.Statement{&ast.ExpressionStatement{Token: start, Expression: body}},
+	}
+
+	return fn
+}
+
+// x |> f(y) is f(x, y) and x |> f is f(x)
+func (p *Parser) parsePipeExpression(left ast.Expression) ast.Expression {
+	pipe := p.curToken
+
+	p.nextToken()
+	right := p.parseExpression(PIPE)
+	if right == nil {
+		return nil
+	}
+
+	if call, ok := right.(*ast.CallExpression); ok {
+		return &ast.CallExpression{
+			Token:     pipe,
+			Function:  call.Function,
+			Arguments: append([]ast.Expression{left}, call.Arguments...),
+			Rparen:    call.Rparen,
+		}
+	}
+	return &ast.CallExpression{Token: pipe, Function: right, Arguments: []ast.Expression{left}}
 }
 
 func (p *Parser) parseFunctionLiteral() ast.Expression {
@@ -413,63 +1171,132 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		Token: p.curToken,
 	}
 
-	if p.peekToken.Type != token.LPAREN {
+	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
-	p.nextToken()
 
 	fn.Arguments = p.parseFunctionArguments()
 
-	if p.peekToken.Type != token.LBRACE {
+	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
-	p.nextToken()
-
+	// a loop around the function literal does not make break valid inside it
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	fn.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
 
 	return fn
 }
 
-func (p *Parser) parseFunctionArguments() []*ast.Identifier {
-	ids := []*ast.Identifier{}
+func (p *Parser) parseFunctionDeclaration() *ast.FunctionDeclaration {
+	fd := &ast.FunctionDeclaration{Token: p.curToken}
 
-	if p.peekToken.Type == token.RPAREN {
-		p.nextToken() // advance token to rparen and return
-		return ids
+	p.nextToken()
+	fd.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	fn, ok := p.parseFunctionLiteral().(*ast.FunctionLiteral)
+	if !ok {
+		return nil
 	}
+	fn.Token = fd.Token
+	fn.Name = fd.Name.Value
+	fd.Function = fn
 
-	p.nextToken() // advance token to next id
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
 
-	id := &ast.Identifier{
-		Token: p.curToken,
-		Value: p.curToken.Literal,
+	return fd
+}
+
+func (p *Parser) parseFunctionArguments() []ast.Expression {
+	params := []ast.Expression{}
+
+	if p.peekToken.Type == token.RPAREN {
+		p.nextToken() // advance token to rparen and return
+		return params
 	}
 
-	ids = append(ids, id)
+	p.nextToken() // advance token to first parameter
+	params = append(params, p.parseFunctionParameter())
 
 	for p.peekToken.Type == token.COMMA {
 		p.nextToken() // advance token to comma
-		p.nextToken() // advance token to next id
+		p.nextToken() // advance token to next parameter
+		params = append(params, p.parseFunctionParameter())
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	p.checkParameters(params)
+	return params
+}
 
-		id := &ast.Identifier{
-			Token: p.curToken,
-			Value: p.curToken.Literal,
+// an identifier, an identifier with a default value, a ...rest parameter,
+// or an array or hash pattern that destructures the argument
+func (p *Parser) parseFunctionParameter() ast.Expression {
+	switch p.curToken.Type {
+	case token.LBRACKET, token.LBRACE:
+		pattern := p.parseExpression(LOWEST)
+		if !p.checkPattern(pattern) {
+			return nil
+		}
+		return pattern
+	case token.IDENT:
+		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if p.peekToken.Type != token.ASSIGN {
+			return ident
 		}
 
-		ids = append(ids, id)
+		p.nextToken()
+		param := &ast.AssignExpression{Token: p.curToken, Target: ident, Operator: "="}
+		p.nextToken()
+		param.Value = p.parseExpression(LOWEST)
+		return param
+	case token.ELLIPSIS:
+		rest := &ast.SpreadExpression{Token: p.curToken}
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		rest.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		return rest
+	default:
+		p.syntaxError(p.curToken.Pos, "invalid parameter %s", p.curToken.Literal)
+		return nil
 	}
+}
 
-	if p.peekToken.Type != token.RPAREN {
-		return nil
+// a rest parameter must be the last one and parameters with defaults can only be followed by other defaults
+func (p *Parser) checkParameters(params []ast.Expression) {
+	hasDefault := false
+	for i, param := range params {
+		switch param := param.(type) {
+		case *ast.SpreadExpression:
+			if i != len(params)-1 {
+				p.addError(param.Pos(), "rest parameter must be the last parameter")
+				return
+			}
+		case *ast.AssignExpression:
+			hasDefault = true
+		case nil:
+			// already reported by parseFunctionParameter
+		default:
+			if hasDefault {
+				p.addError(param.Pos(), "parameter %s without default follows a parameter with default", param)
+				return
+			}
+		}
 	}
-	p.nextToken()
-	return ids
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	call := &ast.CallExpression{Token: p.curToken, Function: function}
 	call.Arguments = p.parseCallArguments()
+	call.Rparen = p.curToken
 	return call
 }
 
@@ -483,25 +1310,56 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 
 	p.nextToken()
 
-	args = append(args, p.parseExpression(LOWEST))
+	args = append(args, p.parseCallArgument())
 
 	for p.peekToken.Type == token.COMMA {
 		p.nextToken()
 		p.nextToken()
-		args = append(args, p.parseExpression(LOWEST))
+		args = append(args, p.parseCallArgument())
 	}
 
-	if p.peekToken.Type != token.RPAREN {
+	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
+	p.checkCallArguments(args)
+	return args
+}
 
+// keyword arguments come after every positional one, so arguments are evaluated in source order
+func (p *Parser) checkCallArguments(args []ast.Expression) {
+	hasKeyword := false
+	for _, arg := range args {
+		switch arg.(type) {
+		case *ast.KeywordArgument:
+			hasKeyword = true
+		case nil:
+			// already reported by parseCallArgument
+		default:
+			if hasKeyword {
+				p.addError(arg.Pos(), "positional argument %s follows a keyword argument", arg)
+				return
+			}
+		}
+	}
+}
+
+// an expression, ...expression to spread an array, or name: expression to pass a keyword argument
+func (p *Parser) parseCallArgument() ast.Expression {
+	if p.curToken.Type != token.IDENT || p.peekToken.Type != token.COLON {
+		return p.parseExpression(LOWEST)
+	}
+
+	arg := &ast.KeywordArgument{Name: &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}}
 	p.nextToken()
-	return args
+	arg.Token = p.curToken
+	p.nextToken()
+	arg.Value = p.parseExpression(LOWEST)
+
+	return arg
 }
 
-func (p *Parser) noPrefixParseError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+func (p *Parser) noPrefixParseError(tk token.Token) {
+	p.syntaxError(tk.Pos, "no prefix parse function for %s found", tk.Type)
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
@@ -580,18 +1438,23 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := p.prefixParseFns[p.curToken.Type] // returns function associated with token type
 
 	if prefix == nil {
-		p.noPrefixParseError(p.curToken.Type)
+		p.noPrefixParseError(p.curToken)
 		return nil
 	}
 
 	leftExpression := prefix() // calls function associated with token type and returns prefix expression in the form of ast.PrefixExpression
 
 	for p.peekToken.Type != token.SEMICOLON && precedence < p.peekPrecedence() {
+		// the left side did not parse, do not build on it
+		if leftExpression == nil {
+			return nil
+		}
+
 		// get infix function
 		infix := p.infixParseFns[p.peekToken.Type]
 
 		if infix == nil {
-			p.noPrefixParseError(p.curToken.Type)
+			p.syntaxError(p.peekToken.Pos, "no infix parse function for %s found", p.peekToken.Type)
 			return nil
 		}
 		p.nextToken() // advances token so that we can parse the new
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"slices"
 	"testing"
 
 	"monkey/ast"
@@ -66,6 +67,32 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestConstStatements(t *testing.T) {
+	input := "const answer = 42; const name = x;"
+
+	l := lexer.New(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+
+	for i, expected := range []string{"const answer = 42;", "const name = x;"} {
+		st, ok := program.Statements[i].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("program.Statements[%d] not *ast.LetStatement. got=%T", i, program.Statements[i])
+		}
+		if st.TokenLiteral() != "const" {
+			t.Errorf("token literal not const, got %q", st.TokenLiteral())
+		}
+		if st.String() != expected {
+			t.Errorf("st.String() wrong. expected=%q, got=%q", expected, st.String())
+		}
+	}
+}
+
 func testLetStatement(t *testing.T, s ast.Statement, expected string) bool {
 	if s.TokenLiteral() != "let" {
 		t.Fatalf("token literal not let, got %q", s.TokenLiteral())
@@ -157,6 +184,39 @@ func TestIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestFloatExpression(t *testing.T) {
+	input := "2.5e2;"
+
+	l := lexer.New(input)
+	par := NewParser(l)
+	prog := par.ParseProgram()
+	checkParserErrors(t, par)
+
+	if len(prog.Statements) != 1 {
+		t.Fatalf("program has %d statements", len(prog.Statements))
+	}
+
+	st, ok := prog.Statements[0].(*ast.ExpressionStatement)
+
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStratement, instead=%T", prog.Statements[0])
+	}
+
+	fl, ok := st.Expression.(*ast.FloatLiteral)
+
+	if !ok {
+		t.Fatalf("exp not *ast.FloatLiteral, instead=%T", st.Expression)
+	}
+
+	if fl.Value != 250 {
+		t.Errorf("fl.Value not 250, got=%v", fl.Value)
+	}
+
+	if fl.TokenLiteral() != "2.5e2" {
+		t.Errorf("fl.TokenLiteral not 2.5e2, got=%v", fl.TokenLiteral())
+	}
+}
+
 func TestPrefixOperator(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -229,13 +289,19 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 - 5;", 5, "-", 5},
 		{"5 * 5;", 5, "*", 5},
 		{"5 / 5;", 5, "/", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"5 ** 5;", 5, "**", 5},
 		{"5 > 5;", 5, ">", 5},
 		{"5 < 5;", 5, "<", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 <= 5;", 5, "<=", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 		{"false == false", false, "==", false},
+		{"true && false", true, "&&", false},
+		{"true || false", true, "||", false},
 	}
 	for _, tt := range infixTests {
 		l := lexer.New(tt.input)
@@ -297,6 +363,70 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a * b / c",
 			"((a * b) / c)",
 		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a < b && c == d || !e",
+			"(((a < b) && (c == d)) || (!e))",
+		},
+		{
+			"a ?? b || c",
+			"(a ?? (b || c))",
+		},
+		{
+			"a ?? b ?? c",
+			"((a ?? b) ?? c)",
+		},
+		{
+			"a > b ? a + 1 : b",
+			"((a > b) ? (a + 1) : b)",
+		},
+		{
+			"a ? b : c ? d : e",
+			"(a ? b : (c ? d : e))",
+		},
+		{
+			"a ? b ? c : d : e",
+			"(a ? (b ? c : d) : e)",
+		},
+		{
+			"x = a ?? b ? c : d",
+			"(x = ((a ?? b) ? c : d))",
+		},
+		{
+			"a?.b?[c]",
+			"((a?[b])?[c])",
+		},
+		{
+			"a?.b[0] + 1",
+			"(((a?[b])[0]) + 1)",
+		},
+		{
+			"a?.b ?? null",
+			"((a?[b]) ?? null)",
+		},
+		{
+			"c ? [1] : [2]",
+			"(c ? [1] : [2])",
+		},
+		{
+			"x == null",
+			"(x == null)",
+		},
+		{
+			"a + b % c",
+			"(a + (b % c))",
+		},
+		{
+			"a * b ** c ** d",
+			"(a * (b ** (c ** d)))",
+		},
 		{
 			"a + b / c",
 			"(a + (b / c))",
@@ -755,3 +885,868 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		testFunc(value)
 	}
 }
+
+func TestNodePositions(t *testing.T) {
+	input := `let x = add(1,
+  2 * 3);
+if (x > 1) { x }
+let e = [];`
+
+	l := lexer.New(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	tests := []struct {
+		node  ast.Node
+		start string
+		end   string
+	}{
+		{program, "1:1", "4:11"},
+		{program.Statements[0], "1:1", "2:9"},
+		{program.Statements[0].(*ast.LetStatement).Value, "1:9", "2:9"},
+		{program.Statements[1], "3:1", "3:17"},
+		{program.Statements[1].(*ast.IfStatement).Condition, "3:5", "3:10"},
+		{program.Statements[2].(*ast.LetStatement).Value, "4:9", "4:11"},
+	}
+
+	for i, tt := range tests {
+		if tt.node.Pos().String() != tt.start {
+			t.Errorf("tests[%d] - start wrong. expected=%s, got=%s", i, tt.start, tt.node.Pos())
+		}
+		if tt.node.End().String() != tt.end {
+			t.Errorf("tests[%d] - end wrong. expected=%s, got=%s", i, tt.end, tt.node.End())
+		}
+	}
+}
+
+func TestParserErrorPositions(t *testing.T) {
+	input := "let x 5;"
+	l := lexer.New(input)
+	p := NewParser(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+
+	expected := "1:7: expected next token to be =, got INT instead"
+	if errors[0] != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, errors[0])
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input    string
+		errors   []string
+		expected string
+	}{
+		{
+			"let x = (1 + 2;\nlet y = 3;\nlet z = ;\nz",
+			[]string{"1:15: expected next token to be ), got ; instead", "3:9: no prefix parse function for ; found"},
+			"let y = 3;z",
+		},
+		{
+			"foo(1, 2\nlet a = 1",
+			[]string{"2:1: expected next token to be ), got LET instead"},
+			"let a = 1;",
+		},
+		{
+			"if (x { y = 1 }\nlet z = 2",
+			[]string{"1:7: expected next token to be ), got { instead"},
+			"let z = 2;",
+		},
+		{
+			"let h = {1: 2 3: 4}; let q = 1",
+			[]string{"1:15: expected next token to be ,, got INT instead"},
+			"let q = 1;",
+		},
+		{
+			"let f = fn(a) { let b = a +; b };\nlet g = fn() { [1, 2 };\nf(1)",
+			[]string{"1:28: no prefix parse function for ; found", "2:22: expected next token to be ], got } instead"},
+			"let f = fn(a)b;let g = fn();f(1)",
+		},
+		{
+			"let f = fn() { foo( }; let g = 1",
+			[]string{"1:21: no prefix parse function for } found"},
+			"let f = fn();let g = 1;",
+		},
+		{
+			"while (x) { a[1; b }\nc",
+			[]string{"1:16: expected next token to be ], got ; instead"},
+			"whilex bc",
+		},
+		{
+			"let x = 1; try { x }",
+			[]string{"1:12: try without catch or finally"},
+			"let x = 1;",
+		},
+		{
+			"let x = fn(a { a }; x",
+			[]string{"1:14: expected next token to be ), got { instead"},
+			"x",
+		},
+		{
+			"while (+) { let = 1 }\nx",
+			[]string{"1:8: no prefix parse function for + found", "1:17: expected next token to be IDENT, got = instead"},
+			"x",
+		},
+		{
+			"let y = \nlet z = (1;\nlet w = 2",
+			[]string{"2:1: no prefix parse function for LET found", "2:11: expected next token to be ), got ; instead"},
+			"let w = 2;",
+		},
+		{
+			"fn f() { let a = \n let b = 1; b }\nlet let = 1; f()",
+			[]string{"2:2: no prefix parse function for LET found", "3:5: expected next token to be IDENT, got LET instead", "3:9: expected next token to be IDENT, got = instead"},
+			"fn f()let b = 1;bf()",
+		},
+		{"x = @; y", []string{"1:5: illegal character '@'"}, "y"},
+		{"throw @; y", []string{"1:7: illegal character '@'"}, "y"},
+		{"while (@) { 1 }\ny", []string{"1:8: illegal character '@'"}, "y"},
+		{"1 ? @ : 2; y", []string{"1:5: illegal character '@'"}, "y"},
+		{"x = 09; y", []string{"1:5: could not parse \"09\" as int"}, "y"},
+		{"let f = fn([a + 1]) { 1 }; y", []string{"1:13: invalid pattern: (a + 1)"}, "y"},
+		{"(x, 1) => x; y", []string{"1:5: invalid parameter 1"}, "y"},
+		{
+			"let x = {1 2}; x",
+			[]string{"1:12: expected next token to be :, got INT instead"},
+			"x",
+		},
+		{"let y = fn(] += 1", []string{"1:12: invalid parameter ]"}, ""},
+		{"x = (1, 2) = 3", []string{"1:12: expected next token to be =>, got = instead"}, ""},
+		{"{: += 1", []string{"1:2: no prefix parse function for : found"}, ""},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+
+		if !slices.Equal(p.Errors(), tt.errors) {
+			t.Errorf("wrong errors for %q. expected=%q, got=%q", tt.input, tt.errors, p.Errors())
+		}
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestCommentsAreSkipped(t *testing.T) {
+	input := `let x = 5; // five
+/* add
+   them */ x + /* inline */ 1`
+
+	l := lexer.New(input)
+	l.KeepComments(true)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expected := "let x = 5;(x + 1)"
+	if program.String() != expected {
+		t.Errorf("expected=%q, got=%q", expected, program.String())
+	}
+}
+
+func TestIllegalTokenErrors(t *testing.T) {
+	l := lexer.New("let x = # 5;")
+	p := NewParser(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+
+	expected := "1:9: illegal character '#'"
+	if errors[0] != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, errors[0])
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < 10) { if (x == 5) { break; } continue; }`
+	l := lexer.New(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+	ws, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.WhileStatement. got=%T",
+			program.Statements[0])
+	}
+	if !testInfixExpression(t, ws.Condition, "x", "<", 10) {
+		return
+	}
+	if len(ws.Body.Statements) != 2 {
+		t.Fatalf("body is not 2 statements. got=%d\n", len(ws.Body.Statements))
+	}
+	if _, ok := ws.Body.Statements[1].(*ast.ContinueStatement); !ok {
+		t.Fatalf("Statements[1] is not ast.ContinueStatement. got=%T", ws.Body.Statements[1])
+	}
+	if ws.String() != "while(x < 10) if(x == 5) break;continue;" {
+		t.Errorf("ws.String() wrong. got=%q", ws.String())
+	}
+}
+
+func TestWhileStatementSemicolon(t *testing.T) {
+	l := lexer.New("while (false) { }; x")
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			2, len(program.Statements))
+	}
+	if _, ok := program.Statements[0].(*ast.WhileStatement); !ok {
+		t.Fatalf("program.Statements[0] is not ast.WhileStatement. got=%T", program.Statements[0])
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "1:1: break outside loop"},
+		{"if (true) { continue }", "1:13: continue outside loop"},
+		{"while (true) { fn() { break; } }", "1:23: break outside loop"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("expected 1 parser error for %q, got=%v", tt.input, errors)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestTryStatement(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedParam string
+		hasCatch      bool
+		hasFinally    bool
+		expected      string
+	}{
+		{"try { x } catch (e) { e }", "e", true, false, "try x catch (e) e"},
+		{"try { x } catch { 1 }", "", true, false, "try x catch 1"},
+		{"try { x } finally { y }", "", false, true, "try x finally y"},
+		{"try { x } catch (err) { 1 } finally { y };", "err", true, true, "try x catch (err) 1 finally y"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+				1, len(program.Statements))
+		}
+		ts, ok := program.Statements[0].(*ast.TryStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.TryStatement. got=%T",
+				program.Statements[0])
+		}
+		if tt.expectedParam == "" && ts.Param != nil {
+			t.Errorf("ts.Param is not nil. got=%q", ts.Param.String())
+		}
+		if tt.expectedParam != "" && !testIdentifier(t, ts.Param, tt.expectedParam) {
+			return
+		}
+		if (ts.Catch != nil) != tt.hasCatch {
+			t.Errorf("ts.Catch wrong. expected present=%t, got=%v", tt.hasCatch, ts.Catch)
+		}
+		if (ts.Finally != nil) != tt.hasFinally {
+			t.Errorf("ts.Finally wrong. expected present=%t, got=%v", tt.hasFinally, ts.Finally)
+		}
+		if ts.String() != tt.expected {
+			t.Errorf("ts.String() wrong. expected=%q, got=%q", tt.expected, ts.String())
+		}
+	}
+}
+
+func TestTryWithoutHandler(t *testing.T) {
+	l := lexer.New("let x = 1; try { x }")
+	p := NewParser(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	expected := "1:12: try without catch or finally"
+	if len(errors) != 1 || errors[0] != expected {
+		t.Errorf("wrong errors. expected=[%q], got=%v", expected, errors)
+	}
+}
+
+func TestThrowStatement(t *testing.T) {
+	l := lexer.New(`throw "bad" + x; 1`)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			2, len(program.Statements))
+	}
+	ts, ok := program.Statements[0].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ThrowStatement. got=%T",
+			program.Statements[0])
+	}
+	if ts.String() != "throw (bad + x);" {
+		t.Errorf("ts.String() wrong. got=%q", ts.String())
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedKey   string
+		expectedValue string
+		expected      string
+	}{
+		{"for (x in arr) { x }", "", "x", "for(x in arr) x"},
+		{"for (k, v in h) { k + v }", "k", "v", "for(k, v in h) (k + v)"},
+		{"for (i in range(0, 10)) { if (i > 5) { break } }", "", "i", "for(i in range(0, 10)) if(i > 5) break;"},
+		{"for (x in [1]) { };", "", "x", "for(x in [1]) "},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		fs, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ForStatement. got=%T", program.Statements[0])
+		}
+		if tt.expectedKey == "" && fs.Key != nil {
+			t.Errorf("fs.Key not nil. got=%s", fs.Key)
+		}
+		if tt.expectedKey != "" && !testIdentifier(t, fs.Key, tt.expectedKey) {
+			return
+		}
+		if !testIdentifier(t, fs.Value, tt.expectedValue) {
+			return
+		}
+		if fs.String() != tt.expected {
+			t.Errorf("fs.String() wrong. expected=%q, got=%q", tt.expected, fs.String())
+		}
+	}
+}
+
+func TestAssignExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5", "(x = 5)"},
+		{"x += 1 + 2", "(x += (1 + 2))"},
+		{"x -= y * 2", "(x -= (y * 2))"},
+		{"x *= 2", "(x *= 2)"},
+		{"x /= 2", "(x /= 2)"},
+		{"a = b = 5", "(a = (b = 5))"},
+		{"x = y || z", "(x = (y || z))"},
+		{"f(x = 1)", "f((x = 1))"},
+		{"arr[0] = 5", "((arr[0]) = 5)"},
+		{"h[\"a\"] += arr[1]", "((h[a]) += (arr[1]))"},
+		{"m[0][1] = 2", "(((m[0])[1]) = 2)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 = 2", "1:3: cannot assign to 1"},
+		{"a + b = 2", "1:7: cannot assign to (a + b)"},
+		{"f() = 2", "1:5: cannot assign to f()"},
+	}
+
+	for _, tt := range errorTests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("expected 1 parser error for %q, got=%v", tt.input, errors)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestConditionalExpressionErrors(t *testing.T) {
+	l := lexer.New("a ? b c")
+	p := NewParser(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 || errors[0] != "1:7: expected next token to be :, got IDENT instead" {
+		t.Errorf("wrong errors. got=%v", errors)
+	}
+}
+
+func TestOptionalAccess(t *testing.T) {
+	input := "config?.server?[\"port\"]"
+
+	l := lexer.New(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	outer, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+	}
+	if !outer.Optional || outer.Index.String() != "port" {
+		t.Errorf("outer access wrong. got=%s", outer)
+	}
+
+	inner, ok := outer.Left.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("outer.Left not *ast.IndexExpression. got=%T", outer.Left)
+	}
+	if _, ok := inner.Index.(*ast.StringLiteral); !ok || !inner.Optional || inner.Index.String() != "server" {
+		t.Errorf("inner access wrong. got=%s", inner)
+	}
+	if inner.End().String() != "1:15" {
+		t.Errorf("wrong end for ?. access. got=%s", inner.End())
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"a?.b = 1", "1:6: cannot assign to optional access (a?[b])"},
+		{"a?.1", "1:4: expected next token to be IDENT, got INT instead"},
+	}
+
+	for _, tt := range errorTests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected=%q, got=%v", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	input := `match (x) {
+  0 => "zero",
+  -1 => "minus one",
+  [head, ...tail] if head > 0 => head,
+  {"type": t} => { t }
+  _ => null,
+}`
+
+	l := lexer.New(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	me, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.MatchExpression. got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, me.Subject, "x") {
+		return
+	}
+
+	expectedArms := []string{
+		"0 => zero",
+		"(-1) => minus one",
+		"[head, ...tail] if (head > 0) => head",
+		"{type:t} => t",
+		"_ => null",
+	}
+	if len(me.Arms) != len(expectedArms) {
+		t.Fatalf("wrong number of arms. expected=%d, got=%d", len(expectedArms), len(me.Arms))
+	}
+	for i, expected := range expectedArms {
+		if me.Arms[i].String() != expected {
+			t.Errorf("arms[%d] wrong. expected=%q, got=%q", i, expected, me.Arms[i].String())
+		}
+	}
+	if _, ok := me.Arms[3].Body.(*ast.BlockStatement); !ok {
+		t.Errorf("arms[3].Body not *ast.BlockStatement. got=%T", me.Arms[3].Body)
+	}
+	if me.End().String() != "7:2" {
+		t.Errorf("wrong end. got=%s", me.End())
+	}
+}
+
+func TestMatchExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"match (x) { 1 + 2 => 3 }", "1:13: invalid pattern: (1 + 2)"},
+		{"match (x) { [...a, b] => 3 }", "1:14: rest pattern must be the last element"},
+		{"match (x) { [...f()] => 3 }", "1:14: rest pattern must be an identifier, got f()"},
+		{"match (x) { {k: 1} => 3 }", "1:14: hash pattern keys must be literals, got k"},
+		{"match (x) { 1 => 2 3 => 4 }", "1:20: expected next token to be ,, got INT instead"},
+		{"match (x) { 1 2 }", "1:15: expected next token to be =>, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected=%q, got=%v", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestDestructuringParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b, ...rest] = arr;", "let [a, b, ...rest] = arr;"},
+		{`let {"name": n} = h;`, "let {name:n} = h;"},
+		{"const [x, [y, _]] = pairs;", "const [x, [y, _]] = pairs;"},
+		{"fn([a, b], {\"k\": v}, c) { a }", "fn([a, b], {k:v}, c)a"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	st := parseLet(t, "let [a, b] = arr;")
+	if st.Name != nil {
+		t.Errorf("st.Name not nil for a pattern. got=%s", st.Name)
+	}
+	if _, ok := st.Pattern.(*ast.ArrayLiteral); !ok {
+		t.Errorf("st.Pattern not *ast.ArrayLiteral. got=%T", st.Pattern)
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a + 1] = arr;", "1:6: invalid pattern: (a + 1)"},
+		{"let [a] arr;", "1:9: expected next token to be =, got IDENT instead"},
+		{"fn(1) { 1 }", "1:4: invalid parameter 1"},
+		{"fn([...a, b]) { 1 }", "1:5: rest pattern must be the last element"},
+	}
+
+	for _, tt := range errorTests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected=%q, got=%v", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestParameterAndArgumentParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(x, y = 10) { x }", "fn(x, (y = 10))x"},
+		{"fn(first, ...rest) { rest }", "fn(first, ...rest)rest"},
+		{"fn(a, b = a * 2, ...c) { c }", "fn(a, (b = (a * 2)), ...c)c"},
+		{"f(...arr)", "f(...arr)"},
+		{"f(1, ...a, ...b)", "f(1, ...a, ...b)"},
+		{"f(1, y: 2)", "f(1, y: 2)"},
+		{"f(1, ...a, y: 2, z: 3)", "f(1, ...a, y: 2, z: 3)"},
+		{"f(y: a ? b : c)", "f(y: (a ? b : c))"},
+		{"f(a ? b : c)", "f((a ? b : c))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(...rest, x) { x }", "1:4: rest parameter must be the last parameter"},
+		{"fn(x = 1, y) { y }", "1:11: parameter y without default follows a parameter with default"},
+		{"fn(...[a]) { a }", "1:7: expected next token to be IDENT, got [ instead"},
+		{"f(b: 1, 2)", "1:9: positional argument 2 follows a keyword argument"},
+		{"f(1, b: 1, ...c)", "1:12: positional argument ...c follows a keyword argument"},
+	}
+
+	for _, tt := range errorTests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected=%q, got=%v", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestFunctionDeclaration(t *testing.T) {
+	input := `fn add(x, y) { x + y } let sub = fn(x, y) { x - y }; fn(x) { x }`
+
+	l := lexer.New(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("program.Statements does not contain 3 statements. got=%d", len(program.Statements))
+	}
+
+	fd, ok := program.Statements[0].(*ast.FunctionDeclaration)
+	if !ok {
+		t.Fatalf("program.Statements[0] not *ast.FunctionDeclaration. got=%T", program.Statements[0])
+	}
+	if !testIdentifier(t, fd.Name, "add") {
+		return
+	}
+	if fd.Function.Name != "add" || len(fd.Function.Arguments) != 2 {
+		t.Errorf("fd.Function wrong. name=%q, arguments=%d", fd.Function.Name, len(fd.Function.Arguments))
+	}
+	if fd.String() != "fn add(x, y)(x + y)" {
+		t.Errorf("fd.String() wrong. got=%q", fd.String())
+	}
+	if fd.End().String() != "1:23" {
+		t.Errorf("wrong end. got=%s", fd.End())
+	}
+
+	let := program.Statements[1].(*ast.LetStatement)
+	if name := let.Value.(*ast.FunctionLiteral).Name; name != "sub" {
+		t.Errorf("let did not name the function. got=%q", name)
+	}
+
+	anonymous := program.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if anonymous.Name != "" {
+		t.Errorf("anonymous function has a name. got=%q", anonymous.Name)
+	}
+}
+
+func TestArrowFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x => x * 3", "(x) => (x * 3)"},
+		{"(a, b) => a + b", "(a, b) => (a + b)"},
+		{"() => 1", "() => 1"},
+		{"(x) => x", "(x) => x"},
+		{"(x, y = 2, ...rest) => rest", "(x, (y = 2), ...rest) => rest"},
+		{"([a, b]) => a", "([a, b]) => a"},
+		{"a => b => a + b", "(a) => (b) => (a + b)"},
+		{"x => { let y = x; y }", "(x) => let y = x;y"},
+		{"let f = x => x ? 1 : 2;", "let f = (x) => (x ? 1 : 2);"},
+		{"f = x => x", "(f = (x) => x)"},
+		{"map(arr, x => x * 2)", "map(arr, (x) => (x * 2))"},
+		{"(x)", "x"},
+		{"(1 + 2) * 3", "((1 + 2) * 3)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	fn := parseLet(t, "let double = x => x * 2;").Value.(*ast.FunctionLiteral)
+	if fn.Name != "double" || len(fn.Arguments) != 1 {
+		t.Errorf("arrow function wrong. name=%q, arguments=%d", fn.Name, len(fn.Arguments))
+	}
+	if fn.End().String() != "1:24" {
+		t.Errorf("wrong end. got=%s", fn.End())
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 => 2", "1:3: invalid arrow function parameters 1"},
+		{"(a, 1) => a", "1:5: invalid parameter 1"},
+		{"(a, b)", "1:7: expected next token to be =>, got EOF instead"},
+		{"()", "1:3: expected next token to be =>, got EOF instead"},
+		{"(a += 1) => a", "1:2: invalid parameter (a += 1)"},
+	}
+
+	for _, tt := range errorTests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected=%q, got=%v", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestPipeExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x |> f", "f(x)"},
+		{"arr |> map(double) |> sum", "sum(map(arr, double))"},
+		{"a + b |> f(c)", "f((a + b), c)"},
+		{"a ?? b |> f", "f((a ?? b))"},
+		{"x |> (y => y * 2)", "(y) => (y * 2)(x)"},
+		{"let r = x |> f;", "let r = f(x);"},
+		{"c ? x |> f : y", "(c ? f(x) : y)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	l := lexer.New("xs |> f(1)")
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	call := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	if call.Pos().String() != "1:1" || call.End().String() != "1:11" {
+		t.Errorf("wrong pipe positions. got=%s-%s", call.Pos(), call.End())
+	}
+}
+
+func parseLet(t *testing.T, input string) *ast.LetStatement {
+	l := lexer.New(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	st, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] not *ast.LetStatement. got=%T", program.Statements[0])
+	}
+	return st
+}
+
+func TestElseIfChain(t *testing.T) {
+	input := `if (x < 0) { -1 } else if (x == 0) { 0 } else if (x < 10) { 1 } else { 2 }`
+
+	l := lexer.New(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	is, ok := program.Statements[0].(*ast.IfStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.IfStatement. got=%T", program.Statements[0])
+	}
+
+	depth := 0
+	for is.Alternative != nil && len(is.Alternative.Statements) == 1 {
+		nested, ok := is.Alternative.Statements[0].(*ast.IfStatement)
+		if !ok {
+			break
+		}
+		is = nested
+		depth++
+	}
+	if depth != 2 {
+		t.Errorf("wrong number of else if branches. expected=2, got=%d", depth)
+	}
+	if is.Alternative == nil || is.Alternative.String() != "2" {
+		t.Errorf("last else branch wrong. got=%v", is.Alternative)
+	}
+
+	expectedEnd := fmt.Sprintf("1:%d", len(input)+1)
+	if program.Statements[0].End().String() != expectedEnd {
+		t.Errorf("wrong end. expected=%s, got=%s", expectedEnd, program.Statements[0].End())
+	}
+}
+
+func TestIfAsExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = if (c) { 1 } else { 2 };", "let x = ifc 1else 2;"},
+		{"f(if (c) { a } else { b }, 3)", "f(ifc aelse b, 3)"},
+		{"let y = if (a) { 1 } else if (b) { 2 } else { 3 }; y", "let y = ifa 1else ifb 2else 3;y"},
+		{"[if (c) { 1 }]", "[ifc 1]"},
+		{"if (c) { 1 }; x", "ifc 1x"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
@@ -50,9 +50,11 @@ func printParserErrors(out io.Writer, errors []string) {
 	}
 }
 
-func REPL(in io.Reader, out io.Writer) error {
+// legacyBlockScope keeps a let inside if/else and while bodies visible after the block, like older scripts expect
+func REPL(in io.Reader, out io.Writer, legacyBlockScope bool) error {
 	scanner := bufio.NewScanner(in)
 	env := object.NewEnviroment()
+	env.SetLegacyBlockScope(legacyBlockScope)
 
 	for {
 		fmt.Printf(">> ")
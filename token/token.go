@@ -1,19 +1,33 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position // position of the first character of the token
+	End     Position // position immediately after the last character of the token
+}
+
+// location of a character in the source, filename is empty when reading from the repl
+type Position struct {
+	Filename string
+	Offset   int // byte offset, starting at 0
+	Line     int // line number, starting at 1
+	Column   int // column number, starting at 1 (byte count)
 }
 
 const (
 	ILLEGAL = "ILLEGAL" // illegal token
 	EOF     = "EOF"
+	COMMENT = "COMMENT" // only produced when the lexer keeps comments
 
 	// identifiers + literals
 	IDENT  = "IDENT" // idx, x, y, etc
 	INT    = "INT"   // 1, 2, 3, etc
+	FLOAT  = "FLOAT" // 1.5, 2e10, 3.1e-4, etc
 	STRING = "STRING"
 
 	// operators
@@ -22,11 +36,33 @@ const (
 	MINUS    = "-"
 	BANG     = "!"
 	ASTERISK = "*"
+	POWER    = "**"
+	PERCENT  = "%"
 	SLASH    = "/"
 	LT       = "<"
 	GT       = ">"
+	LT_EQ    = "<="
+	GT_EQ    = ">="
 	EQ       = "=="
 	NOT_EQ   = "!="
+	AND      = "&&"
+	OR       = "||"
+	QUESTION = "?"
+	NULLISH  = "??"
+
+	// optional access, short-circuits to null when the left side is null
+	OPTIONAL_DOT     = "?."
+	OPTIONAL_BRACKET = "?["
+
+	ARROW    = "=>"
+	ELLIPSIS = "..."
+	PIPE     = "|>"
+
+	// assignment operators, ASSIGN doubles as the plain one
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
 
 	// delimiters
 	COMMA     = ","
@@ -47,16 +83,40 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	WHILE    = "WHILE"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	FOR      = "FOR"
+	IN       = "IN"
+	CONST    = "CONST"
+	NULL     = "NULL"
+	MATCH    = "MATCH"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	THROW    = "THROW"
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"return": RETURN,
-	"if":     IF,
-	"else":   ELSE,
-	"true":   TRUE,
-	"false":  FALSE,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"return":   RETURN,
+	"if":       IF,
+	"else":     ELSE,
+	"true":     TRUE,
+	"false":    FALSE,
+	"while":    WHILE,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"for":      FOR,
+	"in":       IN,
+	"const":    CONST,
+	"null":     NULL,
+	"match":    MATCH,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
+	"throw":    THROW,
 }
 
 func LookupIdent(ident string) TokenType {
@@ -65,3 +125,26 @@ func LookupIdent(ident string) TokenType {
 	}
 	return IDENT
 }
+
+// a position is valid if it was set by the lexer, the zero value is invalid
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// returns file:line:column, line:column or - if the position is invalid
+func (p Position) String() string {
+	s := p.Filename
+
+	if p.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+
+	if s == "" {
+		s = "-"
+	}
+
+	return s
+}